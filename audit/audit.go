@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"tableau_crud/persistance"
+	"time"
+)
+
+type Entry struct {
+	Timestamp    time.Time
+	User         string
+	RemoteAddr   string
+	Connection   string
+	Table        string
+	Operation    string
+	Where        []interface{}
+	Values       map[string]interface{}
+	RowsAffected int64
+}
+
+type Sink interface {
+	Write(entry Entry) error
+	Close() error
+}
+
+type Settings struct {
+	Sink       string
+	Path       string
+	Connection string
+	Table      string
+}
+
+// NewSink builds the sink described by settings.  An empty Sink disables auditing and returns a nil Sink.
+func NewSink(settings Settings, persistors map[string]persistance.Persistor) (Sink, error) {
+	switch settings.Sink {
+	case ``:
+		return nil, nil
+	case `file`:
+		sink, err := NewFileSink(settings.Path)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	case `table`:
+		persistor, ok := persistors[strings.ToLower(settings.Connection)]
+		if !ok {
+			return nil, fmt.Errorf(`audit connection %q is not valid`, settings.Connection)
+		}
+		if settings.Table == `` {
+			return nil, errors.New(`audit table must be provided`)
+		}
+		return NewTableSink(persistor, settings.Table), nil
+	default:
+		return nil, fmt.Errorf(`invalid audit sink %q, expected 'file' or 'table'`, settings.Sink)
+	}
+}
+
+type FileSink struct {
+	file *os.File
+	lock sync.Mutex
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	if path == `` {
+		return nil, errors.New(`audit path must be provided`)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Write(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+type TableSink struct {
+	persistor persistance.Persistor
+	table     string
+}
+
+func NewTableSink(persistor persistance.Persistor, table string) *TableSink {
+	return &TableSink{persistor: persistor, table: table}
+}
+
+func (s *TableSink) Write(entry Entry) error {
+	where, err := json.Marshal(entry.Where)
+	if err != nil {
+		return err
+	}
+	values, err := json.Marshal(entry.Values)
+	if err != nil {
+		return err
+	}
+	// The audit record is written even if the request that caused it was
+	// cancelled, so it does not use the request's context.
+	_, err = s.persistor.Insert(context.Background(), s.table, map[string]interface{}{
+		`AUDIT_TIMESTAMP`: entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		`USER_NAME`:       entry.User,
+		`REMOTE_ADDR`:     entry.RemoteAddr,
+		`CONNECTION_NAME`: entry.Connection,
+		`TABLE_NAME`:      entry.Table,
+		`OPERATION`:       entry.Operation,
+		`WHERE_CLAUSE`:    string(where),
+		`NEW_VALUES`:      string(values),
+		`ROWS_AFFECTED`:   entry.RowsAffected,
+	})
+	return err
+}
+
+func (s *TableSink) Close() error {
+	return nil
+}
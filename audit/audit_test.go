@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `audit.jsonl`)
+	sink, err := NewSink(Settings{Sink: `file`, Path: path}, nil)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	for _, operation := range []string{`insert`, `delete`} {
+		err = sink.Write(Entry{
+			Timestamp:    time.Now(),
+			User:         `ME`,
+			Connection:   `test`,
+			Table:        `TABLEAU_CRUD_TEST`,
+			Operation:    operation,
+			RowsAffected: 1,
+		})
+		if err != nil {
+			t.Fatalf(`got error %v`, err.Error())
+		}
+	}
+	_ = sink.Close()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf(`expected 2 lines but got %v`, len(lines))
+	}
+	var entry Entry
+	err = json.Unmarshal([]byte(lines[1]), &entry)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if entry.Operation != `delete` || entry.User != `ME` {
+		t.Fatalf(`expected delete by ME but got %v by %v`, entry.Operation, entry.User)
+	}
+}
+
+func TestNoSink(t *testing.T) {
+	sink, err := NewSink(Settings{}, nil)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if sink != nil {
+		t.Fatalf(`expected nil sink but got %T`, sink)
+	}
+}
+
+func TestInvalidSink(t *testing.T) {
+	_, err := NewSink(Settings{Sink: `invalid`}, nil)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"tableau_crud/server"
+	"time"
+)
+
+const usage = `usage: tableau_crud [command] [flags]
+
+commands:
+  serve             run the server (default)
+  check-config      validate the settings file and report problems
+  test-connections  run a test query against every configured connection
+  hash-key          print the hash of an API key for use in the settings file
+  gen-key           generate a new API key and its hash
+  encrypt           encrypt a value with the master key for use in the settings file
+
+run 'tableau_crud <command> -h' for the flags of a command`
+
+var commands = map[string]func(args []string) error{
+	`serve`:            serve,
+	`check-config`:     checkConfig,
+	`test-connections`: testConnections,
+	`hash-key`:         hashKey,
+	`gen-key`:          genKey,
+	`encrypt`:          encrypt,
+	`help`: func(_ []string) error {
+		println(usage)
+		return nil
+	},
+}
+
+func configFlag(flags *flag.FlagSet) *string {
+	return flags.String(`config`, filepath.Join(`.`, `server.json`), `path to the settings file (JSON, YAML or TOML)`)
+}
+
+func serve(args []string) error {
+	flags := flag.NewFlagSet(`serve`, flag.ExitOnError)
+	config := configFlag(flags)
+	cert := flags.String(`cert`, filepath.Join(`.`, `cert.pem`), `path to the TLS certificate`)
+	key := flags.String(`key`, filepath.Join(`.`, `key.pem`), `path to the TLS private key`)
+	html := flags.String(`html`, filepath.Join(`.`, `html`), `path to the extension's html folder`)
+	watch := flags.Duration(`watch`, 5*time.Second, `how often to check the settings file for changes; 0 disables reloading on change`)
+	_ = flags.Parse(args)
+
+	println(`loading server...`)
+	s, err := server.LoadServer(*config)
+	if err != nil {
+		return err
+	}
+	s.HtmlPath = *html
+	httpServer := s.HttpServer()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		if s.Settings.UseTls {
+			println(fmt.Sprintf(`listening on %v with SSL`, s.Settings.Address))
+			listenErr <- httpServer.ListenAndServeTLS(*cert, *key)
+			return
+		}
+		println(fmt.Sprintf(`listening on %v`, s.Settings.Address))
+		listenErr <- httpServer.ListenAndServe()
+	}()
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		if *watch > 0 {
+			s.WatchSettings(watchCtx, *watch)
+		}
+	}()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	// stopReloading makes sure that no reload starts once the server begins
+	// shutting down. SIGHUP is ignored rather than reset so that it does not
+	// kill the process while requests drain.
+	stopReloading := func() {
+		signal.Ignore(syscall.SIGHUP)
+		stopWatching()
+		<-watching
+	}
+
+waiting:
+	for {
+		select {
+		case err = <-listenErr:
+			stopReloading()
+			return errors.Join(err, s.Close())
+		case <-hangup:
+			if err := s.Reload(); err != nil {
+				println(fmt.Sprintf(`received SIGHUP, reload rejected: %v`, err.Error()))
+				continue
+			}
+			println(`received SIGHUP, settings reloaded`)
+		case sig := <-stop:
+			println(fmt.Sprintf(`received %v, draining requests...`, sig))
+			break waiting
+		}
+	}
+	stopReloading()
+
+	ctx := context.Background()
+	if timeout := s.Settings.Timeouts.ShutdownTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err = httpServer.Shutdown(ctx)
+	if err == nil {
+		err = <-listenErr
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	}
+	return errors.Join(err, s.Close())
+}
+
+func checkConfig(args []string) error {
+	flags := flag.NewFlagSet(`check-config`, flag.ExitOnError)
+	config := configFlag(flags)
+	_ = flags.Parse(args)
+
+	problems := server.CheckSettings(*config)
+	for _, problem := range problems {
+		println(problem.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf(`%v found %v problem(s)`, *config, len(problems))
+	}
+	println(fmt.Sprintf(`%v is valid`, *config))
+	return nil
+}
+
+func testConnections(args []string) error {
+	flags := flag.NewFlagSet(`test-connections`, flag.ExitOnError)
+	config := configFlag(flags)
+	table := flags.String(`table`, ``, `table to query; by default only the connection is checked`)
+	timeout := flags.Duration(`timeout`, 30*time.Second, `timeout for each connection`)
+	_ = flags.Parse(args)
+
+	s, err := server.LoadServer(*config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+	failed := 0
+	for _, conn := range s.Settings.Connections {
+		persistor, ok := s.Persistors[strings.ToLower(conn.Name)]
+		if !ok {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		_, err = persistor.TestConnection(ctx, *table)
+		cancel()
+		if err != nil {
+			failed++
+			println(fmt.Sprintf(`%v: FAILED: %v`, conn.Name, err.Error()))
+			continue
+		}
+		println(fmt.Sprintf(`%v: ok`, conn.Name))
+	}
+	if failed > 0 {
+		return fmt.Errorf(`%v of %v connection(s) failed`, failed, len(s.Settings.Connections))
+	}
+	return nil
+}
+
+// argOrStdin reads the value from stdin when it is not given as an argument
+// so that it does not end up in the shell history.
+func argOrStdin(flags *flag.FlagSet, name string) (string, error) {
+	value := flags.Arg(0)
+	if value == `` {
+		println(fmt.Sprintf(`enter %v:`, name))
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == `` {
+			return ``, err
+		}
+		value = strings.TrimSpace(line)
+	}
+	if value == `` {
+		return ``, fmt.Errorf(`%v is required`, name)
+	}
+	return value, nil
+}
+
+func hashKey(args []string) error {
+	flags := flag.NewFlagSet(`hash-key`, flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	key, err := argOrStdin(flags, `the API key`)
+	if err != nil {
+		return err
+	}
+	fmt.Println(server.HashApiKey(key))
+	return nil
+}
+
+func genKey(args []string) error {
+	flags := flag.NewFlagSet(`gen-key`, flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	key, err := server.GenerateApiKey()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("api key:  %v\nhash:     %v\n", key, server.HashApiKey(key))
+	return nil
+}
+
+// encrypt creates the master key the first time it is used at the default
+// location next to the settings file. A key chosen with -master-key or the
+// settings' MasterKey must already exist, so that a mistyped path does not
+// silently encrypt with a new key the server will never read. The key must
+// be kept on the host that runs the server.
+func encrypt(args []string) error {
+	flags := flag.NewFlagSet(`encrypt`, flag.ExitOnError)
+	config := configFlag(flags)
+	masterKey := flags.String(`master-key`, ``, `path to the master key; defaults to the settings' MasterKey or master.key next to the settings file`)
+	_ = flags.Parse(args)
+
+	path, configured := *masterKey, *masterKey != ``
+	if !configured {
+		var err error
+		path, configured, err = server.SettingsMasterKeyPath(*config)
+		if err != nil {
+			return err
+		}
+	}
+	key, err := server.LoadMasterKey(path)
+	if errors.Is(err, os.ErrNotExist) && !configured {
+		key, err = server.GenerateMasterKey(path)
+		if err == nil {
+			println(fmt.Sprintf(`created master key %v`, path))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	value, err := argOrStdin(flags, `the value to encrypt`)
+	if err != nil {
+		return err
+	}
+	encrypted, err := server.EncryptSecret(key, value)
+	if err != nil {
+		return err
+	}
+	fmt.Println(encrypted)
+	return nil
+}
@@ -1,7 +1,146 @@
 package error_messaging
 
-import "fmt"
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/snowflakedb/gosnowflake"
+	"net"
+	"strings"
+)
 
-func GenerateErrorMessage(message string, err error) string {
-	return fmt.Sprintf("%v:\n%v", message, err.Error())
+type Kind int
+
+const (
+	// Unknown is returned for every error that is not recognised. Its
+	// message is generic; the error itself must only be logged.
+	Unknown Kind = iota
+	// InvalidRequest is returned for a UserError raised by this server's own
+	// validation; its message is written for users and is safe to show.
+	InvalidRequest
+	DatabaseError
+	ConstraintViolation
+	MissingObject
+	PermissionDenied
+	Timeout
+	TypeMismatch
+	InvalidQuery
+	Unavailable
+	// Canceled is returned when the client went away before the request
+	// finished. It is not a failure of the server or the database.
+	Canceled
+)
+
+// UserError marks an error whose message is safe to show to dashboard users.
+type UserError struct {
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return e.Message
+}
+
+func NewUserError(message string) error {
+	return &UserError{Message: message}
+}
+
+func UserErrorf(format string, args ...interface{}) error {
+	return &UserError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Classification is the part of an error that is safe to show to dashboard
+// users. The raw error must only be logged.
+type Classification struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+var classifications = map[Kind]Classification{
+	Unknown:             {Kind: Unknown, Code: `internal_error`, Message: `an unexpected error occurred`},
+	DatabaseError:       {Kind: DatabaseError, Code: `database_error`, Message: `the database returned an unexpected error`},
+	ConstraintViolation: {Kind: ConstraintViolation, Code: `constraint_violation`, Message: `the change violates a constraint on the table, such as a required or unique column`},
+	MissingObject:       {Kind: MissingObject, Code: `object_not_found`, Message: `a table or column in the request does not exist or is not authorized`},
+	PermissionDenied:    {Kind: PermissionDenied, Code: `permission_denied`, Message: `the connection is not allowed to perform this operation`},
+	Timeout:             {Kind: Timeout, Code: `database_timeout`, Message: `the database did not respond in time`},
+	TypeMismatch:        {Kind: TypeMismatch, Code: `invalid_value`, Message: `a value does not match the type of its column`},
+	InvalidQuery:        {Kind: InvalidQuery, Code: `invalid_query`, Message: `the database could not run the request as given`},
+	Unavailable:         {Kind: Unavailable, Code: `database_unavailable`, Message: `the database could not be reached or rejected the connection's credentials`},
+	Canceled:            {Kind: Canceled, Code: `request_canceled`, Message: `the request was canceled before it finished`},
+}
+
+// Snowflake error numbers that are more specific than their SQLSTATE.
+var snowflakeNumbers = map[int]Kind{
+	604:    Timeout,
+	630:    Timeout,
+	904:    MissingObject,
+	2003:   MissingObject,
+	2043:   MissingObject,
+	3001:   PermissionDenied,
+	100035: TypeMismatch,
+	100038: TypeMismatch,
+	100040: TypeMismatch,
+	100072: ConstraintViolation,
+	390100: Unavailable,
+	390144: Unavailable,
+}
+
+func Classify(err error) Classification {
+	var userErr *UserError
+	if errors.As(err, &userErr) {
+		return Classification{Kind: InvalidRequest, Code: `invalid_request`, Message: userErr.Message}
+	}
+	return classifications[kindOf(err)]
+}
+
+func kindOf(err error) Kind {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+	var snowflakeErr *gosnowflake.SnowflakeError
+	if errors.As(err, &snowflakeErr) {
+		if kind, ok := snowflakeNumbers[snowflakeErr.Number]; ok {
+			return kind
+		}
+		if snowflakeErr.Number >= gosnowflake.ErrCodeEmptyAccountCode && snowflakeErr.Number <= gosnowflake.ErrFailedToHeartbeat {
+			return Unavailable
+		}
+		return sqlStateKind(snowflakeErr.SQLState)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return Timeout
+		}
+		return Unavailable
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return Unavailable
+	}
+	return Unknown
+}
+
+func sqlStateKind(sqlState string) Kind {
+	switch {
+	case sqlState == `42S02` || sqlState == `42S22` || sqlState == `02000`:
+		return MissingObject
+	case sqlState == `42501` || strings.HasPrefix(sqlState, `28`):
+		return PermissionDenied
+	case sqlState == `57014`:
+		return Timeout
+	case strings.HasPrefix(sqlState, `23`):
+		return ConstraintViolation
+	case strings.HasPrefix(sqlState, `22`):
+		return TypeMismatch
+	case strings.HasPrefix(sqlState, `42`):
+		return InvalidQuery
+	case strings.HasPrefix(sqlState, `08`):
+		return Unavailable
+	default:
+		return DatabaseError
+	}
 }
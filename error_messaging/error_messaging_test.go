@@ -0,0 +1,58 @@
+package error_messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/snowflakedb/gosnowflake"
+	"strings"
+	"testing"
+)
+
+func TestClassifySnowflakeErrors(t *testing.T) {
+	cases := []struct {
+		err  *gosnowflake.SnowflakeError
+		kind Kind
+	}{
+		{&gosnowflake.SnowflakeError{Number: 2003, SQLState: `42S02`}, MissingObject},
+		{&gosnowflake.SnowflakeError{Number: 3001, SQLState: `42501`}, PermissionDenied},
+		{&gosnowflake.SnowflakeError{Number: 100072, SQLState: `22000`}, ConstraintViolation},
+		{&gosnowflake.SnowflakeError{Number: 100038, SQLState: `22018`}, TypeMismatch},
+		{&gosnowflake.SnowflakeError{Number: 630, SQLState: `57014`}, Timeout},
+		{&gosnowflake.SnowflakeError{Number: 1003, SQLState: `42000`}, InvalidQuery},
+		{&gosnowflake.SnowflakeError{Number: 99999, SQLState: `23505`}, ConstraintViolation},
+		{&gosnowflake.SnowflakeError{Number: gosnowflake.ErrFailedToAuth}, Unavailable},
+		{&gosnowflake.SnowflakeError{Number: 99999}, DatabaseError},
+	}
+	for _, c := range cases {
+		if kind := Classify(fmt.Errorf(`wrapped: %w`, c.err)).Kind; kind != c.kind {
+			t.Fatalf(`expected kind %v for %v but got %v`, c.kind, c.err.Error(), kind)
+		}
+	}
+}
+
+func TestClassifyHidesDriverMessage(t *testing.T) {
+	classification := Classify(&gosnowflake.SnowflakeError{Number: 2003, SQLState: `42S02`, Message: `Object 'DB.SCHEMA.SECRET' does not exist`})
+	if strings.Contains(classification.Message, `SECRET`) {
+		t.Fatalf(`expected driver details to be hidden but got '%v'`, classification.Message)
+	}
+}
+
+func TestClassifyOtherErrors(t *testing.T) {
+	if kind := Classify(context.DeadlineExceeded).Kind; kind != Timeout {
+		t.Fatalf(`expected Timeout but got %v`, kind)
+	}
+	classification := Classify(fmt.Errorf(`reading: %w`, NewUserError(`page token is not valid`)))
+	if classification.Kind != InvalidRequest || classification.Message != `page token is not valid` {
+		t.Fatalf(`expected user error to pass through but got %+v`, classification)
+	}
+	if kind := Classify(fmt.Errorf(`reading: %w`, context.Canceled)).Kind; kind != Canceled {
+		t.Fatalf(`expected Canceled but got %v`, kind)
+	}
+	for _, err := range []error{errors.New(`sql: database is closed`)} {
+		classification = Classify(err)
+		if classification.Kind != Unknown || strings.Contains(classification.Message, `sql`) {
+			t.Fatalf(`expected a generic message for %v but got %+v`, err, classification)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package expressions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (e *Expression) Evaluate(variables map[string]interface{}) (interface{}, error) {
+	return e.root.eval(variables)
+}
+
+func (e *Expression) EvaluateBool(variables map[string]interface{}) (bool, error) {
+	value, err := e.Evaluate(variables)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+type node interface {
+	eval(variables map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(_ map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(variables map[string]interface{}) (interface{}, error) {
+	return normalize(variables[n.name]), nil
+}
+
+type unaryNode struct {
+	operator string
+	operand  node
+}
+
+func (n *unaryNode) eval(variables map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(variables)
+	if err != nil {
+		return nil, err
+	}
+	if n.operator == `!` {
+		return !truthy(value), nil
+	}
+	if value == nil {
+		return nil, nil
+	}
+	number, ok := toNumber(value)
+	if !ok {
+		return nil, fmt.Errorf(`cannot negate %v`, value)
+	}
+	return -number, nil
+}
+
+type binaryNode struct {
+	operator string
+	left     node
+	right    node
+}
+
+func (n *binaryNode) eval(variables map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(variables)
+	if err != nil {
+		return nil, err
+	}
+	switch n.operator {
+	case `&&`:
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(variables)
+		return truthy(right), err
+	case `||`:
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(variables)
+		return truthy(right), err
+	}
+	right, err := n.right.eval(variables)
+	if err != nil {
+		return nil, err
+	}
+	switch n.operator {
+	case `==`:
+		return equal(left, right), nil
+	case `!=`:
+		return !equal(left, right), nil
+	case `<`, `<=`, `>`, `>=`:
+		comparison, ok := compare(left, right)
+		if !ok {
+			return false, nil
+		}
+		switch n.operator {
+		case `<`:
+			return comparison < 0, nil
+		case `<=`:
+			return comparison <= 0, nil
+		case `>`:
+			return comparison > 0, nil
+		default:
+			return comparison >= 0, nil
+		}
+	}
+	return arithmetic(n.operator, left, right)
+}
+
+type callNode struct {
+	name     string
+	function function
+	args     []node
+}
+
+func (n *callNode) eval(variables map[string]interface{}) (interface{}, error) {
+	if n.name == `if` {
+		condition, err := n.args[0].eval(variables)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(condition) {
+			return n.args[1].eval(variables)
+		}
+		return n.args[2].eval(variables)
+	}
+	args := make([]interface{}, len(n.args))
+	for index, arg := range n.args {
+		value, err := arg.eval(variables)
+		if err != nil {
+			return nil, err
+		}
+		args[index] = value
+	}
+	return n.function.call(args)
+}
+
+func arithmetic(operator string, left interface{}, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	leftStr, leftIsStr := left.(string)
+	rightStr, rightIsStr := right.(string)
+	if operator == `+` && (leftIsStr || rightIsStr) {
+		if !leftIsStr {
+			leftStr = toString(left)
+		}
+		if !rightIsStr {
+			rightStr = toString(right)
+		}
+		return leftStr + rightStr, nil
+	}
+	leftNum, leftOk := toNumber(left)
+	rightNum, rightOk := toNumber(right)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf(`cannot apply '%v' to %v and %v`, operator, left, right)
+	}
+	switch operator {
+	case `+`:
+		return leftNum + rightNum, nil
+	case `-`:
+		return leftNum - rightNum, nil
+	case `*`:
+		return leftNum * rightNum, nil
+	case `/`:
+		if rightNum == 0 {
+			return nil, errors.New(`division by zero`)
+		}
+		return leftNum / rightNum, nil
+	case `%`:
+		if rightNum == 0 {
+			return nil, errors.New(`division by zero`)
+		}
+		return math.Mod(leftNum, rightNum), nil
+	}
+	return nil, fmt.Errorf(`unknown operator '%v'`, operator)
+}
+
+func equal(left interface{}, right interface{}) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	comparison, ok := compare(left, right)
+	if ok {
+		return comparison == 0
+	}
+	return toString(left) == toString(right)
+}
+
+func compare(left interface{}, right interface{}) (int, bool) {
+	if left == nil || right == nil {
+		return 0, false
+	}
+	if leftNum, ok := toNumber(left); ok {
+		if rightNum, ok := toNumber(right); ok {
+			return compareOrdered(leftNum, rightNum), true
+		}
+	}
+	if leftTime, ok := toTime(left); ok {
+		if rightTime, ok := toTime(right); ok {
+			return leftTime.Compare(rightTime), true
+		}
+	}
+	leftBool, leftIsBool := left.(bool)
+	rightBool, rightIsBool := right.(bool)
+	if leftIsBool || rightIsBool {
+		if leftIsBool && rightIsBool && leftBool == rightBool {
+			return 0, true
+		}
+		return 0, false
+	}
+	return strings.Compare(toString(left), toString(right)), true
+}
+
+func compareOrdered(left float64, right float64) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func normalize(value interface{}) interface{} {
+	switch t := value.(type) {
+	case int:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	default:
+		return value
+	}
+}
+
+func truthy(value interface{}) bool {
+	switch t := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ``
+	default:
+		return true
+	}
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch t := normalize(value).(type) {
+	case float64:
+		return t, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+var timeLayouts = []string{time.RFC3339Nano, `2006-01-02T15:04:05.999999999`, `2006-01-02 15:04:05.999999999`, `2006-01-02`}
+
+func toTime(value interface{}) (time.Time, bool) {
+	switch t := value.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		for _, layout := range timeLayouts {
+			parsed, err := time.Parse(layout, t)
+			if err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func toString(value interface{}) string {
+	switch t := value.(type) {
+	case nil:
+		return ``
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf(`%v`, t)
+	}
+}
@@ -0,0 +1,112 @@
+package expressions
+
+import (
+	"testing"
+)
+
+func evaluate(t *testing.T, source string, variables map[string]interface{}) interface{} {
+	expression, err := Compile(source)
+	if err != nil {
+		t.Fatalf(`got error compiling '%v': %v`, source, err.Error())
+	}
+	value, err := expression.Evaluate(variables)
+	if err != nil {
+		t.Fatalf(`got error evaluating '%v': %v`, source, err.Error())
+	}
+	return value
+}
+
+func TestArithmeticPrecedence(t *testing.T) {
+	if value := evaluate(t, `1 + 2 * 3 - -4`, nil); value != 11.0 {
+		t.Fatalf(`expected 11 but got %v`, value)
+	}
+	if value := evaluate(t, `(1 + 2) * 3 % 4`, nil); value != 1.0 {
+		t.Fatalf(`expected 1 but got %v`, value)
+	}
+}
+
+func TestDateComparison(t *testing.T) {
+	variables := map[string]interface{}{`OPENED`: `2020-01-01`, `CLOSED`: `2020-01-02T00:00:00Z`}
+	if value := evaluate(t, `CLOSED >= OPENED`, variables); value != true {
+		t.Fatalf(`expected true but got %v`, value)
+	}
+	variables[`CLOSED`] = `2019-12-31`
+	if value := evaluate(t, `CLOSED >= OPENED`, variables); value != false {
+		t.Fatalf(`expected false but got %v`, value)
+	}
+}
+
+func TestRequiredWhenSet(t *testing.T) {
+	source := `isNull(CLOSED) or isSet(RESOLUTION)`
+	if value := evaluate(t, source, map[string]interface{}{`CLOSED`: nil}); value != true {
+		t.Fatalf(`expected true but got %v`, value)
+	}
+	if value := evaluate(t, source, map[string]interface{}{`CLOSED`: `2020-01-01`, `RESOLUTION`: ` `}); value != false {
+		t.Fatalf(`expected false but got %v`, value)
+	}
+}
+
+func TestNullComparisonsAreFalse(t *testing.T) {
+	if value := evaluate(t, `AMOUNT > 0`, nil); value != false {
+		t.Fatalf(`expected false but got %v`, value)
+	}
+	if value := evaluate(t, `AMOUNT == null and not (AMOUNT != null)`, nil); value != true {
+		t.Fatalf(`expected true but got %v`, value)
+	}
+}
+
+func TestFunctionsAndBracketedFields(t *testing.T) {
+	variables := map[string]interface{}{`First Name`: `ada`, `LAST`: `Lovelace`, `QTY`: 3}
+	value := evaluate(t, `if(QTY > 2, upper([First Name]) + ' ' + LAST, 'few')`, variables)
+	if value != `ADA Lovelace` {
+		t.Fatalf(`expected 'ADA Lovelace' but got %v`, value)
+	}
+	if value := evaluate(t, `round(max(1.234, QTY / 2), 1)`, variables); value != 1.5 {
+		t.Fatalf(`expected 1.5 but got %v`, value)
+	}
+	if value := evaluate(t, `coalesce(MISSING, "default")`, variables); value != `default` {
+		t.Fatalf(`expected default but got %v`, value)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	expression, err := Compile(`CLOSED >= OPENED and len(NAME) < 10`)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	variables := expression.Variables()
+	if len(variables) != 3 || variables[0] != `CLOSED` || variables[1] != `NAME` || variables[2] != `OPENED` {
+		t.Fatalf(`expected [CLOSED NAME OPENED] but got %v`, variables)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, source := range []string{`1 +`, `(1`, `unknown(1)`, `len(1, 2)`, `'unterminated`, `1 $ 2`} {
+		_, err := Compile(source)
+		if err == nil {
+			t.Fatalf(`expected error compiling '%v' but got none`, source)
+		}
+		t.Log(err.Error())
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	expression, err := Compile(`1 / QTY`)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	_, err = expression.Evaluate(map[string]interface{}{`QTY`: 0.0})
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+}
+
+func TestNotBindsTighterThanComparison(t *testing.T) {
+	variables := map[string]interface{}{`A`: false, `B`: true}
+	if value := evaluate(t, `!A == B`, variables); value != true {
+		t.Fatalf(`expected (!A) == B to be true but got %v`, value)
+	}
+	if value := evaluate(t, `!A && !B`, variables); value != false {
+		t.Fatalf(`expected false but got %v`, value)
+	}
+}
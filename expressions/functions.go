@@ -0,0 +1,179 @@
+package expressions
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type function struct {
+	minArgs int
+	maxArgs int
+	call    func(args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	`if`:         {minArgs: 3, maxArgs: 3},
+	`isnull`:     {minArgs: 1, maxArgs: 1, call: isNull},
+	`isset`:      {minArgs: 1, maxArgs: 1, call: isSet},
+	`coalesce`:   {minArgs: 1, maxArgs: -1, call: coalesce},
+	`len`:        {minArgs: 1, maxArgs: 1, call: length},
+	`upper`:      {minArgs: 1, maxArgs: 1, call: stringFunction(strings.ToUpper)},
+	`lower`:      {minArgs: 1, maxArgs: 1, call: stringFunction(strings.ToLower)},
+	`trim`:       {minArgs: 1, maxArgs: 1, call: stringFunction(strings.TrimSpace)},
+	`concat`:     {minArgs: 1, maxArgs: -1, call: concat},
+	`contains`:   {minArgs: 2, maxArgs: 2, call: contains},
+	`startswith`: {minArgs: 2, maxArgs: 2, call: startsWith},
+	`abs`:        {minArgs: 1, maxArgs: 1, call: numberFunction(math.Abs)},
+	`round`:      {minArgs: 1, maxArgs: 2, call: round},
+	`min`:        {minArgs: 1, maxArgs: -1, call: extreme(-1)},
+	`max`:        {minArgs: 1, maxArgs: -1, call: extreme(1)},
+	`now`:        {minArgs: 0, maxArgs: 0, call: now},
+	`today`:      {minArgs: 0, maxArgs: 0, call: today},
+	`date`:       {minArgs: 1, maxArgs: 1, call: date},
+	`days`:       {minArgs: 2, maxArgs: 2, call: days},
+}
+
+func isNull(args []interface{}) (interface{}, error) {
+	return args[0] == nil, nil
+}
+
+func isSet(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return false, nil
+	}
+	str, ok := args[0].(string)
+	return !ok || strings.TrimSpace(str) != ``, nil
+}
+
+func coalesce(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+func length(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return float64(0), nil
+	}
+	return float64(utf8.RuneCountInString(toString(args[0]))), nil
+}
+
+func stringFunction(apply func(string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return apply(toString(args[0])), nil
+	}
+}
+
+func concat(args []interface{}) (interface{}, error) {
+	var builder strings.Builder
+	for _, arg := range args {
+		builder.WriteString(toString(arg))
+	}
+	return builder.String(), nil
+}
+
+func contains(args []interface{}) (interface{}, error) {
+	return strings.Contains(toString(args[0]), toString(args[1])), nil
+}
+
+func startsWith(args []interface{}) (interface{}, error) {
+	return strings.HasPrefix(toString(args[0]), toString(args[1])), nil
+}
+
+func numberFunction(apply func(float64) float64) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		number, ok := toNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf(`%v is not a number`, args[0])
+		}
+		return apply(number), nil
+	}
+}
+
+func round(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	number, ok := toNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf(`%v is not a number`, args[0])
+	}
+	places := 0.0
+	if len(args) == 2 {
+		places, ok = toNumber(args[1])
+		if !ok {
+			return nil, fmt.Errorf(`%v is not a number`, args[1])
+		}
+	}
+	scale := math.Pow(10, places)
+	return math.Round(number*scale) / scale, nil
+}
+
+func extreme(direction int) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		var result interface{}
+		for _, arg := range args {
+			if arg == nil {
+				continue
+			}
+			if result == nil {
+				result = arg
+				continue
+			}
+			comparison, ok := compare(arg, result)
+			if !ok {
+				return nil, fmt.Errorf(`cannot compare %v and %v`, arg, result)
+			}
+			if comparison*direction > 0 {
+				result = arg
+			}
+		}
+		return result, nil
+	}
+}
+
+func now(_ []interface{}) (interface{}, error) {
+	return time.Now().UTC(), nil
+}
+
+func today(_ []interface{}) (interface{}, error) {
+	return time.Now().UTC().Truncate(24 * time.Hour), nil
+}
+
+func date(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	parsed, ok := toTime(args[0])
+	if !ok {
+		return nil, fmt.Errorf(`%v is not a date`, args[0])
+	}
+	return parsed, nil
+}
+
+func days(args []interface{}) (interface{}, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	from, ok := toTime(args[0])
+	if !ok {
+		return nil, fmt.Errorf(`%v is not a date`, args[0])
+	}
+	to, ok := toTime(args[1])
+	if !ok {
+		return nil, fmt.Errorf(`%v is not a date`, args[1])
+	}
+	return to.Sub(from).Hours() / 24, nil
+}
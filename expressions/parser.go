@@ -0,0 +1,292 @@
+package expressions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const maxSourceLength = 4096
+
+type Expression struct {
+	source    string
+	root      node
+	variables []string
+}
+
+func Compile(source string) (*Expression, error) {
+	if len(source) > maxSourceLength {
+		return nil, fmt.Errorf(`expression is longer than %v characters`, maxSourceLength)
+	}
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, variables: make(map[string]bool)}
+	root, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEnd {
+		return nil, fmt.Errorf(`unexpected %q at position %v`, next.text, next.pos)
+	}
+	variables := make([]string, 0, len(p.variables))
+	for variable := range p.variables {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+	return &Expression{source: source, root: root, variables: variables}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+func (e *Expression) Variables() []string {
+	return e.variables
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdentifier
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{`==`, `!=`, `<=`, `>=`, `&&`, `||`, `<`, `>`, `+`, `-`, `*`, `/`, `%`, `!`}
+
+func tokenize(source string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(source)
+	pos := 0
+	for pos < len(runes) {
+		char := runes[pos]
+		switch {
+		case unicode.IsSpace(char):
+			pos++
+		case char == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: `(`, pos: pos})
+			pos++
+		case char == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: `)`, pos: pos})
+			pos++
+		case char == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: `,`, pos: pos})
+			pos++
+		case char == '\'' || char == '"':
+			start := pos
+			var builder strings.Builder
+			pos++
+			for pos < len(runes) && runes[pos] != char {
+				if runes[pos] == '\\' && pos+1 < len(runes) {
+					pos++
+				}
+				builder.WriteRune(runes[pos])
+				pos++
+			}
+			if pos >= len(runes) {
+				return nil, fmt.Errorf(`unterminated string at position %v`, start)
+			}
+			pos++
+			tokens = append(tokens, token{kind: tokenString, text: builder.String(), pos: start})
+		case char == '[':
+			start := pos
+			end := pos + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf(`unterminated field name at position %v`, start)
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: string(runes[start+1 : end]), pos: start})
+			pos = end + 1
+		case unicode.IsDigit(char) || (char == '.' && pos+1 < len(runes) && unicode.IsDigit(runes[pos+1])):
+			start := pos
+			for pos < len(runes) && (unicode.IsDigit(runes[pos]) || runes[pos] == '.') {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:pos]), pos: start})
+		case unicode.IsLetter(char) || char == '_':
+			start := pos
+			for pos < len(runes) && (unicode.IsLetter(runes[pos]) || unicode.IsDigit(runes[pos]) || runes[pos] == '_') {
+				pos++
+			}
+			text := string(runes[start:pos])
+			switch strings.ToLower(text) {
+			case `and`:
+				tokens = append(tokens, token{kind: tokenOperator, text: `&&`, pos: start})
+			case `or`:
+				tokens = append(tokens, token{kind: tokenOperator, text: `||`, pos: start})
+			case `not`:
+				tokens = append(tokens, token{kind: tokenOperator, text: `!`, pos: start})
+			default:
+				tokens = append(tokens, token{kind: tokenIdentifier, text: text, pos: start})
+			}
+		default:
+			matched := false
+			for _, operator := range operators {
+				if strings.HasPrefix(string(runes[pos:]), operator) {
+					tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: pos})
+					pos += len([]rune(operator))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf(`unexpected character %q at position %v`, char, pos)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, pos: pos}), nil
+}
+
+var precedence = map[string]int{
+	`||`: 1,
+	`&&`: 2,
+	`==`: 3, `!=`: 3, `<`: 3, `<=`: 3, `>`: 3, `>=`: 3,
+	`+`: 4, `-`: 4,
+	`*`: 5, `/`: 5, `%`: 5,
+}
+
+const unaryPrecedence = 6
+
+type parser struct {
+	tokens    []token
+	pos       int
+	variables map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseExpression(minPrecedence int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		if operator.kind != tokenOperator {
+			return left, nil
+		}
+		opPrecedence, ok := precedence[operator.text]
+		if !ok || opPrecedence <= minPrecedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpression(opPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: operator.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == `!` || t.text == `-`) {
+		p.next()
+		operand, err := p.parseExpression(unaryPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: t.text, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid number %q at position %v`, t.text, t.pos)
+		}
+		return &literalNode{value: value}, nil
+	case tokenString:
+		return &literalNode{value: t.text}, nil
+	case tokenLeftParen:
+		inner, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, fmt.Errorf(`expected ')' at position %v`, closing.pos)
+		}
+		return inner, nil
+	case tokenIdentifier:
+		if p.peek().kind == tokenLeftParen {
+			return p.parseCall(t)
+		}
+		switch strings.ToLower(t.text) {
+		case `true`:
+			return &literalNode{value: true}, nil
+		case `false`:
+			return &literalNode{value: false}, nil
+		case `null`:
+			return &literalNode{value: nil}, nil
+		}
+		p.variables[t.text] = true
+		return &variableNode{name: t.text}, nil
+	case tokenEnd:
+		return nil, errors.New(`unexpected end of expression`)
+	default:
+		return nil, fmt.Errorf(`unexpected %q at position %v`, t.text, t.pos)
+	}
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	function, ok := functions[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf(`unknown function %q at position %v`, name.text, name.pos)
+	}
+	p.next()
+	args := make([]node, 0)
+	if p.peek().kind == tokenRightParen {
+		p.next()
+	} else {
+		for {
+			arg, err := p.parseExpression(0)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			separator := p.next()
+			if separator.kind == tokenRightParen {
+				break
+			}
+			if separator.kind != tokenComma {
+				return nil, fmt.Errorf(`expected ',' or ')' at position %v`, separator.pos)
+			}
+		}
+	}
+	if len(args) < function.minArgs || (function.maxArgs >= 0 && len(args) > function.maxArgs) {
+		return nil, fmt.Errorf(`wrong number of arguments to %v at position %v`, name.text, name.pos)
+	}
+	return &callNode{name: strings.ToLower(name.text), function: function, args: args}, nil
+}
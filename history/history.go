@@ -0,0 +1,215 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	errorMessaging "tableau_crud/error_messaging"
+	p "tableau_crud/persistance"
+	"time"
+)
+
+// changedAtLayout has a fixed width so that ordering CHANGED_AT as text is
+// the same as ordering it as time, whether the column is a string or a
+// TIMESTAMP_NTZ. time.RFC3339Nano trims trailing zeros and does not sort.
+const changedAtLayout = `2006-01-02T15:04:05.000000000Z`
+
+var Fields = []string{`CHANGE_ID`, `CHANGED_AT`, `CHANGED_BY`, `OPERATION`, `ROW_KEY`, `BEFORE_IMAGE`, `AFTER_IMAGE`, `UNDO_OF`}
+
+// SoftDeleteUpdates are set when the table soft deletes rows. Undoing an
+// insert then applies them instead of deleting the row.
+type Recorder struct {
+	Table             string
+	HistoryTable      string
+	KeyFields         []string
+	User              string
+	SoftDeleteUpdates []p.SqlSnippetGenerator
+}
+
+func (r *Recorder) Insert(ctx context.Context, persistor p.Persistor, values map[string]interface{}) (int64, error) {
+	return runInTransaction(ctx, persistor, func(tx p.Transaction) (int64, error) {
+		result, err := tx.Insert(r.Table, values)
+		if err != nil {
+			return 0, err
+		}
+		err = r.write(tx, `insert`, nil, values)
+		return result, err
+	})
+}
+
+func (r *Recorder) Update(ctx context.Context, persistor p.Persistor, where []p.SqlSnippetGenerator, updates []p.SqlSnippetGenerator) (int64, error) {
+	return runInTransaction(ctx, persistor, func(tx p.Transaction) (int64, error) {
+		before, err := tx.Select(r.Table, where)
+		if err != nil {
+			return 0, err
+		}
+		result, err := tx.Update(r.Table, where, updates)
+		if err != nil {
+			return 0, err
+		}
+		for _, row := range before.Rows() {
+			err = r.write(tx, `update`, row, applyUpdates(row, updates))
+			if err != nil {
+				return 0, err
+			}
+		}
+		return result, nil
+	})
+}
+
+func (r *Recorder) Delete(ctx context.Context, persistor p.Persistor, where []p.SqlSnippetGenerator) (int64, error) {
+	return runInTransaction(ctx, persistor, func(tx p.Transaction) (int64, error) {
+		before, err := tx.Select(r.Table, where)
+		if err != nil {
+			return 0, err
+		}
+		result, err := tx.Delete(r.Table, where)
+		if err != nil {
+			return 0, err
+		}
+		for _, row := range before.Rows() {
+			err = r.write(tx, `delete`, row, nil)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return result, nil
+	})
+}
+
+// Import writes rows with the given function inside tx and records an insert,
+// or an update when the row already existed, for every row written. The rows
+// are read back after writing so that the after images and row keys hold the
+// values the database stored rather than the text of the imported file.
+func (r *Recorder) Import(tx p.Transaction, rows []map[string]interface{}, write func(rows []map[string]interface{}) (int64, error)) (int64, error) {
+	keys := []p.SqlSnippetGenerator{&p.KeysClause{Identifiers: r.KeyFields, Values: p.KeyValues(r.KeyFields, rows)}}
+	existing, err := tx.Select(r.Table, keys)
+	if err != nil {
+		return 0, err
+	}
+	before := p.NewRowIndex(r.KeyFields, existing.Rows())
+	result, err := write(rows)
+	if err != nil {
+		return 0, err
+	}
+	written, err := tx.Select(r.Table, keys)
+	if err != nil {
+		return 0, err
+	}
+	after := p.NewRowIndex(r.KeyFields, written.Rows())
+	for _, row := range rows {
+		image, existed := before.Get(row)
+		stored, ok := after.Get(row)
+		if !ok {
+			stored = mergeImage(image, row)
+		}
+		if existed {
+			err = r.write(tx, `update`, image, stored)
+		} else {
+			err = r.write(tx, `insert`, nil, stored)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return result, nil
+}
+
+func mergeImage(before map[string]interface{}, values map[string]interface{}) map[string]interface{} {
+	after := make(map[string]interface{}, len(before))
+	for field, value := range before {
+		after[field] = value
+	}
+	for field, value := range values {
+		after[field] = value
+	}
+	return after
+}
+
+func (r *Recorder) write(tx p.Transaction, operation string, before map[string]interface{}, after map[string]interface{}) error {
+	keySource := after
+	if keySource == nil {
+		keySource = before
+	}
+	rowKey, err := RowKey(r.KeyFields, keySource)
+	if err != nil {
+		return err
+	}
+	return r.insertRecord(tx, operation, rowKey, before, after, ``)
+}
+
+func (r *Recorder) insertRecord(tx p.Transaction, operation string, rowKey string, before map[string]interface{}, after map[string]interface{}, undoOf string) error {
+	beforeImage, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterImage, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	record := map[string]interface{}{
+		`CHANGE_ID`:    uuid.NewString(),
+		`CHANGED_AT`:   time.Now().UTC().Format(changedAtLayout),
+		`CHANGED_BY`:   r.User,
+		`OPERATION`:    operation,
+		`ROW_KEY`:      rowKey,
+		`BEFORE_IMAGE`: string(beforeImage),
+		`AFTER_IMAGE`:  string(afterImage),
+	}
+	if undoOf != `` {
+		record[`UNDO_OF`] = undoOf
+	}
+	_, err = tx.Insert(r.HistoryTable, record)
+	return err
+}
+
+func Read(ctx context.Context, persistor p.Persistor, historyTable string, keyFields []string, key map[string]interface{}, pageSize int, page int) (*p.QueryResult, error) {
+	rowKey, err := RowKey(keyFields, key)
+	if err != nil {
+		return nil, err
+	}
+	where := []p.SqlSnippetGenerator{&p.EqualClause{Identifier: `ROW_KEY`, Value: rowKey}}
+	return persistor.Read(ctx, p.ReadQuery{Table: historyTable, Fields: Fields, Where: where, OrderBy: []string{`CHANGED_AT`}, PageSize: pageSize, Page: page, IncludeTotal: true})
+}
+
+func RowKey(keyFields []string, row map[string]interface{}) (string, error) {
+	if len(keyFields) == 0 {
+		return ``, errorMessaging.NewUserError(`key fields are required to record history`)
+	}
+	key := make(map[string]interface{}, len(keyFields))
+	for _, field := range keyFields {
+		value, ok := row[field]
+		if !ok {
+			return ``, errorMessaging.UserErrorf(`key field %q is missing`, field)
+		}
+		key[field] = value
+	}
+	keyBytes, err := json.Marshal(key)
+	return string(keyBytes), err
+}
+
+func applyUpdates(row map[string]interface{}, updates []p.SqlSnippetGenerator) map[string]interface{} {
+	after := make(map[string]interface{}, len(row))
+	for field, value := range row {
+		after[field] = value
+	}
+	for _, generator := range updates {
+		if update, ok := generator.(*p.UpdateClause); ok {
+			after[update.Identifier] = update.NewValue
+		}
+	}
+	return after
+}
+
+func runInTransaction(ctx context.Context, persistor p.Persistor, run func(tx p.Transaction) (int64, error)) (int64, error) {
+	tx, err := persistor.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	result, err := run(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	return result, tx.Commit()
+}
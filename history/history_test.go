@@ -0,0 +1,373 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	p "tableau_crud/persistance"
+	"testing"
+	"time"
+)
+
+type fakePersistor struct {
+	tables     map[string][]map[string]interface{}
+	queries    []p.SelectQuery
+	committed  bool
+	rolledBack bool
+	failUpdate bool
+}
+
+type fakeTx struct {
+	*fakePersistor
+}
+
+func newFakePersistor(rows ...map[string]interface{}) *fakePersistor {
+	return &fakePersistor{tables: map[string][]map[string]interface{}{`TEST`: rows}}
+}
+
+func (f *fakeTx) Insert(table string, values map[string]interface{}) (int64, error) {
+	f.tables[table] = append(f.tables[table], values)
+	return 1, nil
+}
+
+func (f *fakeTx) Update(table string, where []p.SqlSnippetGenerator, updates []p.SqlSnippetGenerator) (int64, error) {
+	if f.failUpdate {
+		return 0, errors.New(`update failed`)
+	}
+	var count int64
+	for _, row := range f.tables[table] {
+		if !matches(row, where) {
+			continue
+		}
+		for _, update := range updates {
+			clause := update.(*p.UpdateClause)
+			row[clause.Identifier] = clause.NewValue
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (f *fakeTx) Delete(table string, where []p.SqlSnippetGenerator) (int64, error) {
+	kept := make([]map[string]interface{}, 0)
+	for _, row := range f.tables[table] {
+		if !matches(row, where) {
+			kept = append(kept, row)
+		}
+	}
+	count := len(f.tables[table]) - len(kept)
+	f.tables[table] = kept
+	return int64(count), nil
+}
+
+func (f *fakeTx) InsertMany(table string, rows []map[string]interface{}) (int64, error) {
+	f.tables[table] = append(f.tables[table], rows...)
+	return int64(len(rows)), nil
+}
+
+func (f *fakeTx) Merge(table string, keyFields []string, _ []string, rows []map[string]interface{}) (int64, error) {
+	for _, row := range rows {
+		existing, _ := f.Select(table, keyWhere(keyFields, row))
+		if existing.RowCount == 0 {
+			f.tables[table] = append(f.tables[table], row)
+			continue
+		}
+		for _, current := range f.tables[table] {
+			if matches(current, keyWhere(keyFields, row)) {
+				for field, value := range row {
+					current[field] = value
+				}
+			}
+		}
+	}
+	return int64(len(rows)), nil
+}
+
+func (f *fakeTx) Select(table string, where []p.SqlSnippetGenerator) (*p.QueryResult, error) {
+	columns := make([]string, 0)
+	seen := make(map[string]bool)
+	rows := make([]map[string]interface{}, 0)
+	for _, row := range f.tables[table] {
+		if !matches(row, where) {
+			continue
+		}
+		rows = append(rows, row)
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	result := &p.QueryResult{ColumnNames: columns, RowCount: len(rows), Data: make([][]interface{}, len(columns))}
+	for index, column := range columns {
+		for _, row := range rows {
+			result.Data[index] = append(result.Data[index], row[column])
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeTx) Query(query p.SelectQuery) (*p.QueryResult, error) {
+	f.queries = append(f.queries, query)
+	rows := make([]map[string]interface{}, 0)
+	for _, row := range f.tables[query.Table] {
+		if matches(row, query.Where) {
+			rows = append(rows, row)
+		}
+	}
+	if len(query.OrderBy) > 0 {
+		field := query.OrderBy[0]
+		sort.SliceStable(rows, func(i, j int) bool {
+			first, second := fmt.Sprintf(`%v`, rows[i][field]), fmt.Sprintf(`%v`, rows[j][field])
+			if query.Descending {
+				return first > second
+			}
+			return first < second
+		})
+	}
+	if query.Limit > 0 && len(rows) > query.Limit {
+		rows = rows[:query.Limit]
+	}
+	result := &p.QueryResult{ColumnNames: query.Fields, RowCount: len(rows), Data: make([][]interface{}, len(query.Fields))}
+	for index, field := range query.Fields {
+		for _, row := range rows {
+			result.Data[index] = append(result.Data[index], row[field])
+		}
+	}
+	return result, nil
+}
+
+func (f *fakePersistor) Insert(_ context.Context, table string, values map[string]interface{}) (int64, error) {
+	return (&fakeTx{f}).Insert(table, values)
+}
+
+func (f *fakePersistor) Update(_ context.Context, table string, where []p.SqlSnippetGenerator, updates []p.SqlSnippetGenerator) (int64, error) {
+	return (&fakeTx{f}).Update(table, where, updates)
+}
+
+func (f *fakePersistor) Delete(_ context.Context, table string, where []p.SqlSnippetGenerator) (int64, error) {
+	return (&fakeTx{f}).Delete(table, where)
+}
+
+func (f *fakePersistor) Read(_ context.Context, query p.ReadQuery) (*p.QueryResult, error) {
+	return (&fakeTx{f}).Select(query.Table, query.Where)
+}
+
+func (f *fakePersistor) Export(_ context.Context, _ p.ExportQuery, _ p.RowWriter) error {
+	return nil
+}
+
+func (f *fakePersistor) Distinct(_ context.Context, _ p.DistinctQuery) (*p.QueryResult, error) {
+	return &p.QueryResult{}, nil
+}
+
+func (f *fakePersistor) Aggregate(_ context.Context, _ p.AggregateQuery) (*p.QueryResult, error) {
+	return &p.QueryResult{}, nil
+}
+
+func (f *fakePersistor) TestConnection(_ context.Context, _ string) (*p.QueryResult, error) {
+	return &p.QueryResult{}, nil
+}
+
+func (f *fakePersistor) Close() error {
+	return nil
+}
+
+func (f *fakePersistor) Begin(_ context.Context) (p.Transaction, error) {
+	return &fakeTx{f}, nil
+}
+
+func (f *fakeTx) Commit() error {
+	f.committed = true
+	return nil
+}
+
+func (f *fakeTx) Rollback() error {
+	f.rolledBack = true
+	return nil
+}
+
+func matches(row map[string]interface{}, where []p.SqlSnippetGenerator) bool {
+	for _, generator := range where {
+		if clause, ok := generator.(*p.KeysClause); ok {
+			if !matchesAnyKey(row, clause) {
+				return false
+			}
+			continue
+		}
+		switch clause := generator.(type) {
+		case *p.EqualClause:
+			if row[clause.Identifier] != clause.Value {
+				return false
+			}
+		case *p.InClause:
+			found := false
+			for _, value := range clause.Values {
+				found = found || row[clause.Identifier] == value
+			}
+			if found == clause.Exclude {
+				return false
+			}
+		case *p.RangeClause:
+			if fmt.Sprintf(`%v`, row[clause.Identifier]) < fmt.Sprintf(`%v`, clause.MinValue) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesAnyKey(row map[string]interface{}, clause *p.KeysClause) bool {
+	for _, values := range clause.Values {
+		matched := true
+		for index, identifier := range clause.Identifiers {
+			matched = matched && sameValue(row[identifier], values[index])
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue compares values the way the database coerces a text parameter
+// to the column's type.
+func sameValue(stored interface{}, param interface{}) bool {
+	index := p.NewRowIndex([]string{`V`}, []map[string]interface{}{{`V`: stored}})
+	_, ok := index.Get(map[string]interface{}{`V`: param})
+	return ok
+}
+
+func testRecorder() *Recorder {
+	return &Recorder{Table: `TEST`, HistoryTable: `TEST_HISTORY`, KeyFields: []string{`KEY`}, User: `ME`}
+}
+
+func TestUpdateRecordsBeforeAndAfter(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 3.0, `NAME`: `Old Name`})
+	updates := []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `NAME`, NewValue: `New Name`}}
+	result, err := testRecorder().Update(context.Background(), persistor, nil, updates)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if result != 1 {
+		t.Fatalf(`expected 1 row but got %v`, result)
+	}
+	if !persistor.committed {
+		t.Fatalf(`expected transaction to be committed`)
+	}
+	records := persistor.tables[`TEST_HISTORY`]
+	if len(records) != 1 {
+		t.Fatalf(`expected 1 history record but got %v`, len(records))
+	}
+	record := records[0]
+	if record[`ROW_KEY`] != `{"KEY":3}` {
+		t.Fatalf(`expected row key {"KEY":3} but got %v`, record[`ROW_KEY`])
+	}
+	var before, after map[string]interface{}
+	_ = json.Unmarshal([]byte(record[`BEFORE_IMAGE`].(string)), &before)
+	_ = json.Unmarshal([]byte(record[`AFTER_IMAGE`].(string)), &after)
+	if before[`NAME`] != `Old Name` || after[`NAME`] != `New Name` {
+		t.Fatalf(`expected Old Name -> New Name but got %v -> %v`, before[`NAME`], after[`NAME`])
+	}
+}
+
+func TestDeleteRecordsBeforeOnly(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 1.0, `NAME`: `A`}, map[string]interface{}{`KEY`: 2.0, `NAME`: `B`})
+	_, err := testRecorder().Delete(context.Background(), persistor, nil)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	records := persistor.tables[`TEST_HISTORY`]
+	if len(records) != 2 {
+		t.Fatalf(`expected 2 history records but got %v`, len(records))
+	}
+	if records[1][`AFTER_IMAGE`] != `null` {
+		t.Fatalf(`expected null after image but got %v`, records[1][`AFTER_IMAGE`])
+	}
+}
+
+func TestFailedUpdateRollsBack(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 3.0, `NAME`: `Old Name`})
+	persistor.failUpdate = true
+	_, err := testRecorder().Update(context.Background(), persistor, nil, nil)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	if !persistor.rolledBack || persistor.committed {
+		t.Fatalf(`expected transaction to be rolled back`)
+	}
+	if len(persistor.tables[`TEST_HISTORY`]) != 0 {
+		t.Fatalf(`expected no history records`)
+	}
+}
+
+func TestRowKeyMissingField(t *testing.T) {
+	_, err := RowKey([]string{`KEY`}, map[string]interface{}{`NAME`: `A`})
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestImportRecordsInsertsAndUpdates(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 1.0, `NAME`: `Old Name`})
+	rows := []map[string]interface{}{{`KEY`: 1.0, `NAME`: `New Name`}, {`KEY`: 2.0, `NAME`: `B`}}
+	tx := &fakeTx{persistor}
+	_, err := testRecorder().Import(tx, rows, func(rows []map[string]interface{}) (int64, error) {
+		return tx.Merge(`TEST`, []string{`KEY`}, nil, rows)
+	})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	records := persistor.tables[`TEST_HISTORY`]
+	if len(records) != 2 {
+		t.Fatalf(`expected 2 history records but got %v`, len(records))
+	}
+	if records[0][`OPERATION`] != `update` || records[1][`OPERATION`] != `insert` {
+		t.Fatalf(`expected update then insert but got %v then %v`, records[0][`OPERATION`], records[1][`OPERATION`])
+	}
+}
+
+func TestChangedAtSortsAsText(t *testing.T) {
+	earlier := time.Date(2024, 1, 2, 3, 4, 5, 100000000, time.UTC).Format(changedAtLayout)
+	later := time.Date(2024, 1, 2, 3, 4, 5, 120000000, time.UTC).Format(changedAtLayout)
+	if !(earlier < later) {
+		t.Fatalf(`expected %v to sort before %v`, earlier, later)
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, earlier)
+	if err != nil || parsed.Nanosecond() != 100000000 {
+		t.Fatalf(`expected the stored value to parse back but got %v, %v`, parsed, err)
+	}
+}
+
+func TestImportMatchesLargeNumericKeys(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 1000000.0, `NAME`: `Old Name`})
+	rows := []map[string]interface{}{{`KEY`: `1000000`, `NAME`: `New Name`}, {`KEY`: `2000000`, `NAME`: `B`}}
+	tx := &fakeTx{persistor}
+	_, err := testRecorder().Import(tx, rows, func(rows []map[string]interface{}) (int64, error) {
+		for _, row := range rows {
+			key, _ := strconv.ParseFloat(row[`KEY`].(string), 64)
+			_, _ = tx.Merge(`TEST`, []string{`KEY`}, nil, []map[string]interface{}{{`KEY`: key, `NAME`: row[`NAME`]}})
+		}
+		return int64(len(rows)), nil
+	})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	records := persistor.tables[`TEST_HISTORY`]
+	if len(records) != 2 || records[0][`OPERATION`] != `update` || records[1][`OPERATION`] != `insert` {
+		t.Fatalf(`expected update then insert but got %v`, records)
+	}
+	if records[0][`ROW_KEY`] != `{"KEY":1000000}` || records[1][`ROW_KEY`] != `{"KEY":2000000}` {
+		t.Fatalf(`expected numeric row keys but got %v and %v`, records[0][`ROW_KEY`], records[1][`ROW_KEY`])
+	}
+	var before map[string]interface{}
+	_ = json.Unmarshal([]byte(records[0][`BEFORE_IMAGE`].(string)), &before)
+	if before[`NAME`] != `Old Name` {
+		t.Fatalf(`expected the before image of the existing row but got %v`, before)
+	}
+}
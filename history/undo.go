@@ -0,0 +1,281 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	errorMessaging "tableau_crud/error_messaging"
+	p "tableau_crud/persistance"
+	"time"
+)
+
+var ErrConflict = errors.New(`row has been modified since the change was made`)
+
+var ErrAlreadyUndone = errors.New(`change has already been undone`)
+
+type change struct {
+	Id        string
+	ChangedAt time.Time
+	ChangedBy string
+	Operation string
+	RowKey    string
+	UndoOf    string
+	Before    map[string]interface{}
+	After     map[string]interface{}
+}
+
+// changeFields are the history columns needed to undo a change and
+// conflictFields are enough to tell whether its row changed afterwards.
+var changeFields = []string{`CHANGE_ID`, `CHANGED_AT`, `OPERATION`, `ROW_KEY`, `BEFORE_IMAGE`, `AFTER_IMAGE`}
+var conflictFields = []string{`CHANGE_ID`, `CHANGED_AT`, `OPERATION`, `ROW_KEY`, `UNDO_OF`}
+
+func (r *Recorder) Undo(ctx context.Context, persistor p.Persistor, changeId string) (int64, error) {
+	return runInTransaction(ctx, persistor, func(tx p.Transaction) (int64, error) {
+		changes, err := r.selectChanges(tx, p.SelectQuery{Fields: changeFields, Where: []p.SqlSnippetGenerator{&p.EqualClause{Identifier: `CHANGE_ID`, Value: changeId}}})
+		if err != nil {
+			return 0, err
+		}
+		if len(changes) == 0 {
+			return 0, errorMessaging.UserErrorf(`change %q does not exist`, changeId)
+		}
+		if changes[0].Operation == `undo` {
+			return 0, errorMessaging.UserErrorf(`change %q is an undo and cannot be undone`, changeId)
+		}
+		undone, err := r.undone(tx, []interface{}{changeId})
+		if err != nil {
+			return 0, err
+		}
+		if undone[changeId] {
+			return 0, fmt.Errorf(`cannot undo change %q: %w`, changeId, ErrAlreadyUndone)
+		}
+		return r.undoChanges(tx, changes[:1])
+	})
+}
+
+// UndoLast undoes the user's count most recent changes that have not been
+// undone yet. It reads the newest changes a page at a time, doubling the page
+// while changes that were already undone leave it short.
+func (r *Recorder) UndoLast(ctx context.Context, persistor p.Persistor, count int) (int64, error) {
+	if count <= 0 {
+		return 0, errorMessaging.NewUserError(`the number of changes to undo must be greater than 0`)
+	}
+	return runInTransaction(ctx, persistor, func(tx p.Transaction) (int64, error) {
+		where := []p.SqlSnippetGenerator{
+			&p.EqualClause{Identifier: `CHANGED_BY`, Value: r.User},
+			&p.InClause{Identifier: `OPERATION`, Exclude: true, Values: []interface{}{`undo`}},
+		}
+		var toUndo []*change
+		for limit := count; ; limit *= 2 {
+			changes, err := r.selectChanges(tx, p.SelectQuery{Fields: changeFields, Where: where, OrderBy: []string{`CHANGED_AT`}, Descending: true, Limit: limit})
+			if err != nil {
+				return 0, err
+			}
+			ids := make([]interface{}, len(changes))
+			for index, c := range changes {
+				ids[index] = c.Id
+			}
+			undone, err := r.undone(tx, ids)
+			if err != nil {
+				return 0, err
+			}
+			toUndo = make([]*change, 0, count)
+			for _, c := range changes {
+				if len(toUndo) < count && !undone[c.Id] {
+					toUndo = append(toUndo, c)
+				}
+			}
+			if len(toUndo) == count || len(changes) < limit {
+				break
+			}
+		}
+		if len(toUndo) == 0 {
+			return 0, errorMessaging.UserErrorf(`there are no changes by %q to undo`, r.User)
+		}
+		return r.undoChanges(tx, toUndo)
+	})
+}
+
+// undone returns which of the given changes already have an undo record.
+func (r *Recorder) undone(tx p.Transaction, ids []interface{}) (map[string]bool, error) {
+	undone := make(map[string]bool)
+	if len(ids) == 0 {
+		return undone, nil
+	}
+	result, err := tx.Query(p.SelectQuery{Table: r.HistoryTable, Fields: []string{`UNDO_OF`}, Where: []p.SqlSnippetGenerator{&p.InClause{Identifier: `UNDO_OF`, Values: ids}}})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range result.RowValues() {
+		undone[toString(row[0])] = true
+	}
+	return undone, nil
+}
+
+func (r *Recorder) undoChanges(tx p.Transaction, changes []*change) (int64, error) {
+	undoing := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		undoing[c.Id] = true
+	}
+	err := r.checkNotModified(tx, changes, undoing)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range changes {
+		err = r.revert(tx, c)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(changes)), nil
+}
+
+// checkNotModified rejects undoing changes if their rows changed afterwards,
+// by anyone, except for the changes being undone in this transaction and
+// their undo records. It reads the later changes of every row in one query.
+func (r *Recorder) checkNotModified(tx p.Transaction, changes []*change, undoing map[string]bool) error {
+	rowKeys := make([]interface{}, 0, len(changes))
+	seen := make(map[string]bool, len(changes))
+	oldest := changes[0].ChangedAt
+	for _, c := range changes {
+		if !seen[c.RowKey] {
+			seen[c.RowKey] = true
+			rowKeys = append(rowKeys, c.RowKey)
+		}
+		if c.ChangedAt.Before(oldest) {
+			oldest = c.ChangedAt
+		}
+	}
+	where := []p.SqlSnippetGenerator{
+		&p.InClause{Identifier: `ROW_KEY`, Values: rowKeys},
+		&p.RangeClause{Identifier: `CHANGED_AT`, MinValue: oldest.UTC().Format(changedAtLayout)},
+	}
+	rowChanges, err := r.selectChanges(tx, p.SelectQuery{Fields: conflictFields, Where: where})
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		for _, later := range rowChanges {
+			if later.RowKey != c.RowKey || !later.ChangedAt.After(c.ChangedAt) || undoing[later.Id] || (later.Operation == `undo` && undoing[later.UndoOf]) {
+				continue
+			}
+			return fmt.Errorf(`cannot undo change %q: %w`, c.Id, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *Recorder) revert(tx p.Transaction, c *change) error {
+	var err error
+	reverted := c.Before
+	switch c.Operation {
+	case `insert`:
+		if len(r.SoftDeleteUpdates) > 0 {
+			_, err = tx.Update(r.Table, keyWhere(r.KeyFields, c.After), r.SoftDeleteUpdates)
+			reverted = applyUpdates(c.After, r.SoftDeleteUpdates)
+		} else {
+			_, err = tx.Delete(r.Table, keyWhere(r.KeyFields, c.After))
+		}
+	case `update`:
+		updates := make([]p.SqlSnippetGenerator, 0, len(c.Before))
+		for field, value := range c.Before {
+			updates = append(updates, &p.UpdateClause{Identifier: field, NewValue: value})
+		}
+		_, err = tx.Update(r.Table, keyWhere(r.KeyFields, c.After), updates)
+	case `delete`:
+		_, err = tx.Insert(r.Table, c.Before)
+	default:
+		return errorMessaging.UserErrorf(`cannot undo change %q with operation %q`, c.Id, c.Operation)
+	}
+	if err != nil {
+		return err
+	}
+	return r.writeUndo(tx, c, reverted)
+}
+
+func (r *Recorder) writeUndo(tx p.Transaction, c *change, reverted map[string]interface{}) error {
+	keySource := c.Before
+	if keySource == nil {
+		keySource = c.After
+	}
+	rowKey, err := RowKey(r.KeyFields, keySource)
+	if err != nil {
+		return err
+	}
+	return r.insertRecord(tx, `undo`, rowKey, c.After, reverted, c.Id)
+}
+
+func (r *Recorder) selectChanges(tx p.Transaction, query p.SelectQuery) ([]*change, error) {
+	query.Table = r.HistoryTable
+	result, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*change, 0, result.RowCount)
+	for _, row := range result.Rows() {
+		c, err := parseChange(row)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+func parseChange(row map[string]interface{}) (*change, error) {
+	c := &change{
+		Id:        toString(row[`CHANGE_ID`]),
+		ChangedBy: toString(row[`CHANGED_BY`]),
+		Operation: toString(row[`OPERATION`]),
+		RowKey:    toString(row[`ROW_KEY`]),
+		UndoOf:    toString(row[`UNDO_OF`]),
+	}
+	switch changedAt := row[`CHANGED_AT`].(type) {
+	case time.Time:
+		c.ChangedAt = changedAt
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, changedAt)
+		if err != nil {
+			return nil, err
+		}
+		c.ChangedAt = parsed
+	}
+	var err error
+	c.Before, err = parseImage(row[`BEFORE_IMAGE`])
+	if err != nil {
+		return nil, err
+	}
+	c.After, err = parseImage(row[`AFTER_IMAGE`])
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseImage(value interface{}) (map[string]interface{}, error) {
+	image := toString(value)
+	if image == `` {
+		return nil, nil
+	}
+	var parsed map[string]interface{}
+	err := json.Unmarshal([]byte(image), &parsed)
+	return parsed, err
+}
+
+func keyWhere(keyFields []string, row map[string]interface{}) []p.SqlSnippetGenerator {
+	where := make([]p.SqlSnippetGenerator, 0, len(keyFields))
+	for _, field := range keyFields {
+		where = append(where, &p.EqualClause{Identifier: field, Value: row[field]})
+	}
+	return where
+}
+
+func toString(value interface{}) string {
+	if value == nil {
+		return ``
+	}
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return fmt.Sprintf(`%v`, value)
+}
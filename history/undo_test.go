@@ -0,0 +1,184 @@
+package history
+
+import (
+	"context"
+	"errors"
+	p "tableau_crud/persistance"
+	"testing"
+)
+
+func TestUndoUpdate(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 3.0, `NAME`: `Old Name`})
+	recorder := testRecorder()
+	where := []p.SqlSnippetGenerator{&p.EqualClause{Identifier: `KEY`, Value: 3.0}}
+	updates := []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `NAME`, NewValue: `New Name`}}
+	_, err := recorder.Update(context.Background(), persistor, where, updates)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	changeId := persistor.tables[`TEST_HISTORY`][0][`CHANGE_ID`].(string)
+
+	result, err := recorder.Undo(context.Background(), persistor, changeId)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if result != 1 {
+		t.Fatalf(`expected 1 change undone but got %v`, result)
+	}
+	if name := persistor.tables[`TEST`][0][`NAME`]; name != `Old Name` {
+		t.Fatalf(`expected Old Name but got %v`, name)
+	}
+	records := persistor.tables[`TEST_HISTORY`]
+	if len(records) != 2 || records[1][`UNDO_OF`] != changeId {
+		t.Fatalf(`expected an undo record for %v but got %v`, changeId, records)
+	}
+}
+
+func TestUndoLastInsertAndDelete(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 1.0, `NAME`: `A`})
+	recorder := testRecorder()
+	_, err := recorder.Insert(context.Background(), persistor, map[string]interface{}{`KEY`: 2.0, `NAME`: `B`})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	_, err = recorder.Delete(context.Background(), persistor, []p.SqlSnippetGenerator{&p.EqualClause{Identifier: `KEY`, Value: 1.0}})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+
+	result, err := recorder.UndoLast(context.Background(), persistor, 2)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if result != 2 {
+		t.Fatalf(`expected 2 changes undone but got %v`, result)
+	}
+	rows := persistor.tables[`TEST`]
+	if len(rows) != 1 || rows[0][`KEY`] != 1.0 {
+		t.Fatalf(`expected only row 1 to remain but got %v`, rows)
+	}
+
+	_, err = recorder.UndoLast(context.Background(), persistor, 1)
+	if err == nil {
+		t.Fatalf(`expected error when nothing is left to undo but got none`)
+	}
+}
+
+func TestUndoRefusesChangeModifiedByAnotherUser(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 3.0, `NAME`: `Old Name`})
+	recorder := testRecorder()
+	where := []p.SqlSnippetGenerator{&p.EqualClause{Identifier: `KEY`, Value: 3.0}}
+	_, err := recorder.Update(context.Background(), persistor, where, []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `NAME`, NewValue: `Mine`}})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	other := testRecorder()
+	other.User = `SOMEONE ELSE`
+	_, err = other.Update(context.Background(), persistor, where, []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `NAME`, NewValue: `Theirs`}})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+
+	_, err = recorder.UndoLast(context.Background(), persistor, 1)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf(`expected conflict error but got %v`, err)
+	}
+	if name := persistor.tables[`TEST`][0][`NAME`]; name != `Theirs` {
+		t.Fatalf(`expected Theirs but got %v`, name)
+	}
+}
+
+func TestUndoRefusesChangeAlreadyUndone(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 3.0, `NAME`: `A`})
+	recorder := testRecorder()
+	_, err := recorder.Delete(context.Background(), persistor, nil)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	changeId := persistor.tables[`TEST_HISTORY`][0][`CHANGE_ID`].(string)
+	_, err = recorder.Undo(context.Background(), persistor, changeId)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	_, err = recorder.Undo(context.Background(), persistor, changeId)
+	if !errors.Is(err, ErrAlreadyUndone) {
+		t.Fatalf(`expected already undone error but got %v`, err)
+	}
+	if rows := len(persistor.tables[`TEST`]); rows != 1 {
+		t.Fatalf(`expected the row to be restored once but got %v rows`, rows)
+	}
+	undoId := persistor.tables[`TEST_HISTORY`][1][`CHANGE_ID`].(string)
+	_, err = recorder.Undo(context.Background(), persistor, undoId)
+	if err == nil {
+		t.Fatalf(`expected error when undoing an undo record but got none`)
+	}
+}
+
+func TestUndoRefusesChangeFollowedByOwnEdit(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 3.0, `NAME`: `Old Name`})
+	recorder := testRecorder()
+	where := []p.SqlSnippetGenerator{&p.EqualClause{Identifier: `KEY`, Value: 3.0}}
+	_, err := recorder.Update(context.Background(), persistor, where, []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `NAME`, NewValue: `First`}})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	changeId := persistor.tables[`TEST_HISTORY`][0][`CHANGE_ID`].(string)
+	_, err = recorder.Update(context.Background(), persistor, where, []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `NAME`, NewValue: `Second`}})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	_, err = recorder.Undo(context.Background(), persistor, changeId)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf(`expected conflict error but got %v`, err)
+	}
+	if name := persistor.tables[`TEST`][0][`NAME`]; name != `Second` {
+		t.Fatalf(`expected Second but got %v`, name)
+	}
+}
+
+func TestUndoInsertSoftDeletes(t *testing.T) {
+	persistor := newFakePersistor()
+	recorder := testRecorder()
+	recorder.SoftDeleteUpdates = []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `IS_DELETED`, NewValue: true}}
+	_, err := recorder.Insert(context.Background(), persistor, map[string]interface{}{`KEY`: 2.0, `NAME`: `B`})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	_, err = recorder.UndoLast(context.Background(), persistor, 1)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	rows := persistor.tables[`TEST`]
+	if len(rows) != 1 || rows[0][`IS_DELETED`] != true {
+		t.Fatalf(`expected the row to be soft deleted but got %v`, rows)
+	}
+}
+
+func TestUndoLastSkipsUndoneChangesInSql(t *testing.T) {
+	persistor := newFakePersistor(map[string]interface{}{`KEY`: 1.0, `NAME`: `A`}, map[string]interface{}{`KEY`: 2.0, `NAME`: `B`}, map[string]interface{}{`KEY`: 3.0, `NAME`: `C`})
+	recorder := testRecorder()
+	for _, key := range []float64{1, 2, 3} {
+		where := []p.SqlSnippetGenerator{&p.EqualClause{Identifier: `KEY`, Value: key}}
+		_, err := recorder.Update(context.Background(), persistor, where, []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `NAME`, NewValue: `changed`}})
+		if err != nil {
+			t.Fatalf(`got error %v`, err.Error())
+		}
+	}
+	latest := persistor.tables[`TEST_HISTORY`][2][`CHANGE_ID`].(string)
+	if _, err := recorder.Undo(context.Background(), persistor, latest); err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	persistor.queries = nil
+
+	result, err := recorder.UndoLast(context.Background(), persistor, 2)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if result != 2 || persistor.tables[`TEST`][0][`NAME`] != `A` || persistor.tables[`TEST`][1][`NAME`] != `B` {
+		t.Fatalf(`expected the first 2 changes to be undone but got %v`, persistor.tables[`TEST`])
+	}
+	first := persistor.queries[0]
+	if first.Limit != 2 || !first.Descending || len(first.Fields) != len(changeFields) {
+		t.Fatalf(`expected the newest changes to be read with a limit but got %+v`, first)
+	}
+}
@@ -3,29 +3,24 @@ package main
 import (
 	"fmt"
 	_ "github.com/snowflakedb/gosnowflake"
-	"net/http"
-	"path/filepath"
-	"tableau_crud/server"
+	"log"
+	"os"
+	"strings"
 )
 
 func main() {
-	println(`loading server...`)
-	s, err := server.LoadServer(filepath.Join(`.`, `server.json`))
-	if err != nil {
-		println(err.Error())
-		return
+	command, args := `serve`, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], `-`) {
+		command, args = args[0], args[1:]
 	}
-
-	if s.Settings.UseTls {
-		println(fmt.Sprintf(`listening on %v with SSL`, s.Settings.Address))
-		err = http.ListenAndServeTLS(
-			s.Settings.Address,
-			filepath.Join(`.`, `cert.pem`),
-			filepath.Join(`.`, `key.pem`),
-			s.Handler,
-		)
-	} else {
-		println(fmt.Sprintf(`listening on %v`, s.Settings.Address))
-		err = http.ListenAndServe(s.Settings.Address, s.Handler)
+	run, ok := commands[command]
+	if !ok {
+		println(fmt.Sprintf("unknown command %q\n\n%v", command, usage))
+		os.Exit(2)
+	}
+	err := run(args)
+	if err != nil {
+		log.Printf(`%v failed: %v`, command, err.Error())
+		os.Exit(1)
 	}
 }
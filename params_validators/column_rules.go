@@ -0,0 +1,204 @@
+package params_validators
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type ColumnRule struct {
+	Required  bool
+	Min       *float64
+	Max       *float64
+	MaxLength int
+	Pattern   string
+	Enum      []interface{}
+	Lookup    *Lookup
+
+	pattern *regexp.Regexp
+}
+
+type Lookup struct {
+	Table       string
+	Column      string
+	LabelColumn string
+	Values      []LookupValue
+}
+
+type LookupValue struct {
+	Value interface{}
+	Label string
+}
+
+func (l *Lookup) IsStatic() bool {
+	return len(l.Values) > 0
+}
+
+func (l *Lookup) Contains(value interface{}) bool {
+	allowed := make([]interface{}, len(l.Values))
+	for index, lookupValue := range l.Values {
+		allowed[index] = lookupValue.Value
+	}
+	return containsValue(allowed, value)
+}
+
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for index, fieldError := range e.Errors {
+		messages[index] = fmt.Sprintf(`%v: %v`, fieldError.Field, fieldError.Message)
+	}
+	return strings.Join(messages, "\n")
+}
+
+type LookupChecker func(lookup *Lookup, value interface{}) (bool, error)
+
+// CheckColumnRules compiles every pattern when the settings are loaded and
+// keeps the result on the rule so that requests do not compile it again.
+func CheckColumnRules(rules map[string]ColumnRule) error {
+	for field, rule := range rules {
+		if rule.Pattern != `` {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf(`invalid pattern for column %q: %v`, field, err.Error())
+			}
+			rule.pattern = pattern
+			rules[field] = rule
+		}
+		if rule.Lookup != nil && !rule.Lookup.IsStatic() && (rule.Lookup.Table == `` || rule.Lookup.Column == ``) {
+			return fmt.Errorf(`lookup for column %q must have a list of values or a table and column`, field)
+		}
+	}
+	return nil
+}
+
+func ValidateColumns(rules map[string]ColumnRule, values map[string]interface{}, isInsert bool, checkLookup LookupChecker) error {
+	fieldErrors := make([]FieldError, 0)
+	fields := make([]string, 0, len(rules))
+	for field := range rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		rule := rules[field]
+		value, provided := values[field]
+		if !provided && !isInsert {
+			continue
+		}
+		if isBlank(value) {
+			if rule.Required {
+				fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: `required`, Message: `a value is required`})
+			}
+			continue
+		}
+		fieldError, err := validateValue(field, rule, value, checkLookup)
+		if err != nil {
+			return err
+		}
+		if fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return &ValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+func validateValue(field string, rule ColumnRule, value interface{}, checkLookup LookupChecker) (*FieldError, error) {
+	if rule.Min != nil || rule.Max != nil {
+		number, ok := toNumber(value)
+		if !ok {
+			return &FieldError{Field: field, Rule: `number`, Message: `must be a number`}, nil
+		}
+		if rule.Min != nil && number < *rule.Min {
+			return &FieldError{Field: field, Rule: `min`, Message: fmt.Sprintf(`must be at least %v`, *rule.Min)}, nil
+		}
+		if rule.Max != nil && number > *rule.Max {
+			return &FieldError{Field: field, Rule: `max`, Message: fmt.Sprintf(`must be at most %v`, *rule.Max)}, nil
+		}
+	}
+	str, isString := value.(string)
+	if rule.MaxLength > 0 && isString && utf8.RuneCountInString(str) > rule.MaxLength {
+		return &FieldError{Field: field, Rule: `maxLength`, Message: fmt.Sprintf(`must be at most %v characters`, rule.MaxLength)}, nil
+	}
+	if rule.Pattern != `` {
+		pattern := rule.pattern
+		if pattern == nil {
+			var err error
+			pattern, err = regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !pattern.MatchString(fmt.Sprintf(`%v`, value)) {
+			return &FieldError{Field: field, Rule: `pattern`, Message: fmt.Sprintf(`must match the pattern %v`, rule.Pattern)}, nil
+		}
+	}
+	if len(rule.Enum) > 0 && !containsValue(rule.Enum, value) {
+		return &FieldError{Field: field, Rule: `enum`, Message: fmt.Sprintf(`must be one of %v`, rule.Enum)}, nil
+	}
+	if rule.Lookup != nil {
+		found := true
+		if rule.Lookup.IsStatic() {
+			found = rule.Lookup.Contains(value)
+		} else if checkLookup != nil {
+			var err error
+			found, err = checkLookup(rule.Lookup, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !found {
+			return &FieldError{Field: field, Rule: `lookup`, Message: fmt.Sprintf(`'%v' is not a valid value`, value)}, nil
+		}
+	}
+	return nil, nil
+}
+
+func isBlank(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	str, ok := value.(string)
+	return ok && strings.TrimSpace(str) == ``
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch t := value.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case string:
+		number, err := strconv.ParseFloat(t, 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	valueStr := fmt.Sprintf(`%v`, value)
+	for _, allowed := range values {
+		if fmt.Sprintf(`%v`, allowed) == valueStr {
+			return true
+		}
+	}
+	return false
+}
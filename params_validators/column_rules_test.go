@@ -0,0 +1,106 @@
+package params_validators
+
+import (
+	"testing"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+var testRules = map[string]ColumnRule{
+	`NAME`:   {Required: true, MaxLength: 5},
+	`AMOUNT`: {Min: float(0), Max: float(100)},
+	`CODE`:   {Pattern: `^[A-Z]{3}$`},
+	`OBJECT`: {Enum: []interface{}{`Project`, `Task`}},
+	`OWNER`:  {Lookup: &Lookup{Table: `USERS`, Column: `NAME`}},
+}
+
+func lookupUsers(_ *Lookup, value interface{}) (bool, error) {
+	return value == `ME`, nil
+}
+
+func TestValidateColumnsValid(t *testing.T) {
+	values := map[string]interface{}{`NAME`: `Bob`, `AMOUNT`: 50.0, `CODE`: `ABC`, `OBJECT`: `Project`, `OWNER`: `ME`}
+	err := ValidateColumns(testRules, values, true, lookupUsers)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+}
+
+func TestValidateColumnsInvalid(t *testing.T) {
+	values := map[string]interface{}{`NAME`: `Too Long`, `AMOUNT`: 150.0, `CODE`: `abc`, `OBJECT`: `Projct`, `OWNER`: `YOU`}
+	err := ValidateColumns(testRules, values, true, lookupUsers)
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf(`expected a ValidationError but got %v`, err)
+	}
+	expected := []string{`AMOUNT:max`, `CODE:pattern`, `NAME:maxLength`, `OBJECT:enum`, `OWNER:lookup`}
+	if len(validationErr.Errors) != len(expected) {
+		t.Fatalf(`expected %v errors but got %v`, len(expected), validationErr.Errors)
+	}
+	for index, fieldError := range validationErr.Errors {
+		if actual := fieldError.Field + `:` + fieldError.Rule; actual != expected[index] {
+			t.Fatalf(`expected error %v but got %v`, expected[index], actual)
+		}
+	}
+	t.Log(err.Error())
+}
+
+func TestValidateColumnsRequiredOnInsert(t *testing.T) {
+	err := ValidateColumns(testRules, map[string]interface{}{`AMOUNT`: 1.0}, true, nil)
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf(`expected a ValidationError but got %v`, err)
+	}
+	if len(validationErr.Errors) != 1 || validationErr.Errors[0].Rule != `required` {
+		t.Fatalf(`expected a required error but got %v`, validationErr.Errors)
+	}
+}
+
+func TestValidateColumnsUpdateSkipsMissingFields(t *testing.T) {
+	err := ValidateColumns(testRules, map[string]interface{}{`AMOUNT`: `12.5`}, false, nil)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	err = ValidateColumns(testRules, map[string]interface{}{`NAME`: ``}, false, nil)
+	if err == nil {
+		t.Fatalf(`expected a required error but got none`)
+	}
+}
+
+func TestCheckColumnRulesInvalidPattern(t *testing.T) {
+	err := CheckColumnRules(map[string]ColumnRule{`CODE`: {Pattern: `[`}})
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestCheckColumnRulesCompilesPatterns(t *testing.T) {
+	rules := map[string]ColumnRule{`CODE`: {Pattern: `^[A-Z]+$`}}
+	err := CheckColumnRules(rules)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if rules[`CODE`].pattern == nil {
+		t.Fatalf(`expected rule to keep its compiled pattern`)
+	}
+	err = ValidateColumns(rules, map[string]interface{}{`CODE`: `abc`}, true, nil)
+	if err == nil {
+		t.Fatalf(`expected a pattern error but got none`)
+	}
+}
+
+func TestValidateColumnsStaticLookup(t *testing.T) {
+	rules := map[string]ColumnRule{`OBJECT`: {Lookup: &Lookup{Values: []LookupValue{{Value: `Project`}, {Value: `Task`}}}}}
+	err := ValidateColumns(rules, map[string]interface{}{`OBJECT`: `Task`}, true, nil)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	err = ValidateColumns(rules, map[string]interface{}{`OBJECT`: `Projct`}, true, nil)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
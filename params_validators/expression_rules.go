@@ -0,0 +1,224 @@
+package params_validators
+
+import (
+	"fmt"
+	"sort"
+	"tableau_crud/expressions"
+	"time"
+)
+
+type ExpressionRule struct {
+	Expression string
+	Field      string
+	Message    string
+
+	compiled *expressions.Expression
+}
+
+// CheckExpressions compiles every rule when the settings are loaded and
+// keeps the result on the rule so that requests do not compile it again.
+func CheckExpressions(rules []ExpressionRule) error {
+	for index := range rules {
+		compiled, err := expressions.Compile(rules[index].Expression)
+		if err != nil {
+			return fmt.Errorf(`invalid expression in rule %v: %v`, index+1, err.Error())
+		}
+		rules[index].compiled = compiled
+	}
+	return nil
+}
+
+// CompiledDefaults are a table's default expressions, compiled once when the
+// settings are loaded.
+type CompiledDefaults map[string]*expressions.Expression
+
+func CompileDefaults(defaults map[string]string) (CompiledDefaults, error) {
+	compiled := make(CompiledDefaults, len(defaults))
+	for field, source := range defaults {
+		expression, err := expressions.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid default expression for column %q: %v`, field, err.Error())
+		}
+		compiled[field] = expression
+	}
+	return compiled, nil
+}
+
+func ApplyDefaults(defaults map[string]string, values map[string]interface{}) (map[string]interface{}, error) {
+	compiled, err := CompileDefaults(defaults)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.Apply(values)
+}
+
+func (d CompiledDefaults) Apply(values map[string]interface{}) (map[string]interface{}, error) {
+	if len(d) == 0 {
+		return values, nil
+	}
+	applied := make(map[string]interface{}, len(values)+len(d))
+	for key, value := range values {
+		applied[key] = value
+	}
+	fields := make([]string, 0, len(d))
+	for field := range d {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if applied[field] != nil {
+			continue
+		}
+		value, err := d[field].Evaluate(values)
+		if err != nil {
+			return nil, fmt.Errorf(`error computing default for column %q: %v`, field, err.Error())
+		}
+		if timeValue, ok := value.(time.Time); ok {
+			value = timeValue.Format(time.RFC3339Nano)
+		}
+		applied[field] = value
+	}
+	return applied, nil
+}
+
+// ValidateExpressions checks every rule against values. On update only the
+// rules whose fields are all set are checked here; rules the update sets
+// partly are checked against the updated rows by ValidateUpdatedRows.
+func ValidateExpressions(rules []ExpressionRule, values map[string]interface{}, isInsert bool) error {
+	fieldErrors := make([]FieldError, 0)
+	for index, rule := range rules {
+		expression, err := rule.expression()
+		if err != nil {
+			return err
+		}
+		if !isInsert && len(missingVariables(expression, values)) > 0 {
+			continue
+		}
+		fieldError, err := checkRule(index, rule, expression, values)
+		if err != nil {
+			return err
+		}
+		if fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return &ValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+// PartialRuleFields returns the fields that the rules an update sets partly
+// also need, so that they can be read from the rows being updated.
+func PartialRuleFields(rules []ExpressionRule, updates map[string]interface{}) ([]string, error) {
+	present := make(map[string]bool)
+	fields := make([]string, 0)
+	for _, rule := range rules {
+		expression, err := rule.expression()
+		if err != nil {
+			return nil, err
+		}
+		missing := missingVariables(expression, updates)
+		if len(missing) == 0 || len(missing) == len(expression.Variables()) {
+			continue
+		}
+		for _, field := range missing {
+			if !present[field] {
+				present[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// ValidateUpdatedRows checks the rules an update sets partly against every
+// row being updated, merged with the update.
+func ValidateUpdatedRows(rules []ExpressionRule, updates map[string]interface{}, rows []map[string]interface{}) error {
+	fieldErrors := make([]FieldError, 0)
+	for index, rule := range rules {
+		expression, err := rule.expression()
+		if err != nil {
+			return err
+		}
+		missing := missingVariables(expression, updates)
+		if len(missing) == 0 || len(missing) == len(expression.Variables()) {
+			continue
+		}
+		for _, row := range rows {
+			merged := make(map[string]interface{}, len(row)+len(updates))
+			for field, value := range row {
+				merged[field] = value
+			}
+			for field, value := range updates {
+				merged[field] = value
+			}
+			fieldError, err := checkRule(index, rule, expression, merged)
+			if err != nil {
+				return err
+			}
+			if fieldError != nil {
+				fieldErrors = append(fieldErrors, *fieldError)
+				break
+			}
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return &ValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+func (rule ExpressionRule) expression() (*expressions.Expression, error) {
+	if rule.compiled != nil {
+		return rule.compiled, nil
+	}
+	return expressions.Compile(rule.Expression)
+}
+
+func checkRule(index int, rule ExpressionRule, expression *expressions.Expression, values map[string]interface{}) (*FieldError, error) {
+	valid, err := expression.EvaluateBool(values)
+	if err != nil {
+		return nil, fmt.Errorf(`error evaluating rule %v: %v`, index+1, err.Error())
+	}
+	if valid {
+		return nil, nil
+	}
+	message := rule.Message
+	if message == `` {
+		message = fmt.Sprintf(`must satisfy %v`, rule.Expression)
+	}
+	return &FieldError{Field: rule.Field, Rule: `expression`, Message: message}, nil
+}
+
+func MergeValidationErrors(errs ...error) error {
+	fieldErrors := make([]FieldError, 0)
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		validationErr, ok := err.(*ValidationError)
+		if !ok {
+			return err
+		}
+		fieldErrors = append(fieldErrors, validationErr.Errors...)
+	}
+	if len(fieldErrors) > 0 {
+		return &ValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+// missingVariables lists the fields of an expression that an update does not
+// set.
+func missingVariables(expression *expressions.Expression, values map[string]interface{}) []string {
+	missing := make([]string, 0)
+	for _, variable := range expression.Variables() {
+		if _, ok := values[variable]; !ok {
+			missing = append(missing, variable)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,108 @@
+package params_validators
+
+import (
+	"testing"
+)
+
+var testExpressionRules = []ExpressionRule{
+	{Expression: `CLOSED >= OPENED`, Field: `CLOSED`, Message: `must be on or after OPENED`},
+	{Expression: `isNull(CLOSED) or isSet(RESOLUTION)`, Field: `RESOLUTION`},
+}
+
+func TestValidateExpressionsOnInsert(t *testing.T) {
+	values := map[string]interface{}{`OPENED`: `2020-01-02`, `CLOSED`: `2020-01-01`, `RESOLUTION`: ``}
+	err := ValidateExpressions(testExpressionRules, values, true)
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf(`expected a ValidationError but got %v`, err)
+	}
+	if len(validationErr.Errors) != 2 {
+		t.Fatalf(`expected 2 errors but got %v`, validationErr.Errors)
+	}
+	if validationErr.Errors[0].Message != `must be on or after OPENED` {
+		t.Fatalf(`expected configured message but got '%v'`, validationErr.Errors[0].Message)
+	}
+	t.Log(err.Error())
+}
+
+func TestValidateExpressionsOnUpdateSkipsUntouchedRules(t *testing.T) {
+	values := map[string]interface{}{`NOTES`: `unrelated`}
+	err := ValidateExpressions(testExpressionRules, values, false)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+}
+
+func TestValidateExpressionsOnUpdateSkipsPartialRules(t *testing.T) {
+	values := map[string]interface{}{`CLOSED`: `2020-01-01`, `RESOLUTION`: `Fixed`}
+	err := ValidateExpressions(testExpressionRules, values, false)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	fields, err := PartialRuleFields(testExpressionRules, values)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(fields) != 1 || fields[0] != `OPENED` {
+		t.Fatalf(`expected OPENED to be read but got %v`, fields)
+	}
+}
+
+func TestValidateUpdatedRows(t *testing.T) {
+	rules := []ExpressionRule{{Expression: `isNull(CLOSED) or isSet(RESOLUTION)`, Field: `RESOLUTION`}}
+	updates := map[string]interface{}{`RESOLUTION`: `Fixed`}
+	rows := []map[string]interface{}{{`CLOSED`: `2020-01-01`}, {`CLOSED`: nil}}
+	err := ValidateUpdatedRows(rules, updates, rows)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	updates = map[string]interface{}{`CLOSED`: `2020-01-01`}
+	rows = []map[string]interface{}{{`RESOLUTION`: `Fixed`}, {`RESOLUTION`: nil}}
+	err = ValidateUpdatedRows(rules, updates, rows)
+	validationErr, ok := err.(*ValidationError)
+	if !ok || len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != `RESOLUTION` {
+		t.Fatalf(`expected RESOLUTION to be required but got %v`, err)
+	}
+}
+
+func TestCheckExpressionsCompilesRules(t *testing.T) {
+	rules := []ExpressionRule{{Expression: `A > 1`}}
+	err := CheckExpressions(rules)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if rules[0].compiled == nil {
+		t.Fatalf(`expected rule to keep its compiled expression`)
+	}
+	err = CheckExpressions([]ExpressionRule{{Expression: `A >`}})
+	if err == nil {
+		t.Fatalf(`expected error for an invalid expression`)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	defaults := map[string]string{`STATUS`: `if(isNull(CLOSED), 'Open', 'Closed')`, `NAME`: `'unused'`}
+	values, err := ApplyDefaults(defaults, map[string]interface{}{`CLOSED`: nil, `NAME`: `Given`})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if values[`STATUS`] != `Open` {
+		t.Fatalf(`expected Open but got %v`, values[`STATUS`])
+	}
+	if values[`NAME`] != `Given` {
+		t.Fatalf(`expected provided value to be kept but got %v`, values[`NAME`])
+	}
+}
+
+func TestMergeValidationErrors(t *testing.T) {
+	first := &ValidationError{Errors: []FieldError{{Field: `A`}}}
+	second := &ValidationError{Errors: []FieldError{{Field: `B`}}}
+	err := MergeValidationErrors(first, nil, second)
+	merged, ok := err.(*ValidationError)
+	if !ok || len(merged.Errors) != 2 {
+		t.Fatalf(`expected 2 merged errors but got %v`, err)
+	}
+	if MergeValidationErrors(nil, nil) != nil {
+		t.Fatalf(`expected nil when there are no errors`)
+	}
+}
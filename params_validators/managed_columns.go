@@ -0,0 +1,96 @@
+package params_validators
+
+import (
+	"fmt"
+	p "tableau_crud/persistance"
+	"time"
+)
+
+type ManagedColumns struct {
+	CreatedBy          string
+	CreatedOn          string
+	ChangedBy          string
+	ChangedOn          string
+	RejectClientValues bool
+}
+
+func (m ManagedColumns) ApplyToInsert(values map[string]interface{}, user string, now time.Time) (map[string]interface{}, error) {
+	managed := m.insertValues(user, now)
+	applied := make(map[string]interface{}, len(values)+len(managed))
+	for key, value := range values {
+		if _, ok := managed[key]; ok && m.RejectClientValues {
+			return nil, fmt.Errorf(`field %q is managed by the server and cannot be provided`, key)
+		}
+		applied[key] = value
+	}
+	for key, value := range managed {
+		applied[key] = value
+	}
+	return applied, nil
+}
+
+func (m ManagedColumns) ApplyToUpdate(updates []p.SqlSnippetGenerator, user string, now time.Time) ([]p.SqlSnippetGenerator, error) {
+	applied := make([]p.SqlSnippetGenerator, 0, len(updates)+2)
+	for _, generator := range updates {
+		update, ok := generator.(*p.UpdateClause)
+		if ok && m.isManaged(update.Identifier) {
+			if m.RejectClientValues {
+				return nil, fmt.Errorf(`field %q is managed by the server and cannot be provided`, update.Identifier)
+			}
+			continue
+		}
+		applied = append(applied, generator)
+	}
+	return append(applied, m.Updates(user, now)...), nil
+}
+
+func (m ManagedColumns) Updates(user string, now time.Time) []p.SqlSnippetGenerator {
+	managed := m.updateValues(user, now)
+	updates := make([]p.SqlSnippetGenerator, 0, len(managed))
+	for _, key := range []string{m.ChangedBy, m.ChangedOn} {
+		if value, ok := managed[key]; ok {
+			updates = append(updates, &p.UpdateClause{Identifier: key, NewValue: value})
+		}
+	}
+	return updates
+}
+
+// InsertOnly returns the managed columns that must keep their inserted value.
+func (m ManagedColumns) InsertOnly() []string {
+	fields := make([]string, 0, 2)
+	for _, field := range []string{m.CreatedBy, m.CreatedOn} {
+		if field != `` {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (m ManagedColumns) insertValues(user string, now time.Time) map[string]interface{} {
+	values := m.updateValues(user, now)
+	if m.CreatedBy != `` {
+		values[m.CreatedBy] = user
+	}
+	if m.CreatedOn != `` {
+		values[m.CreatedOn] = now.UTC().Format(time.RFC3339Nano)
+	}
+	return values
+}
+
+func (m ManagedColumns) updateValues(user string, now time.Time) map[string]interface{} {
+	values := make(map[string]interface{})
+	if m.ChangedBy != `` {
+		values[m.ChangedBy] = user
+	}
+	if m.ChangedOn != `` {
+		values[m.ChangedOn] = now.UTC().Format(time.RFC3339Nano)
+	}
+	return values
+}
+
+func (m ManagedColumns) isManaged(field string) bool {
+	if field == `` {
+		return false
+	}
+	return field == m.CreatedBy || field == m.CreatedOn || field == m.ChangedBy || field == m.ChangedOn
+}
@@ -0,0 +1,66 @@
+package params_validators
+
+import (
+	p "tableau_crud/persistance"
+	"testing"
+	"time"
+)
+
+var testManagedColumns = ManagedColumns{
+	CreatedBy: `CREATED_BY`,
+	CreatedOn: `CREATED_ON`,
+	ChangedBy: `CHANGED_BY`,
+	ChangedOn: `CHANGED_ON`,
+}
+
+func TestManagedColumnsOverrideInsert(t *testing.T) {
+	now := time.Date(2023, 6, 15, 13, 5, 51, 0, time.UTC)
+	values, err := testManagedColumns.ApplyToInsert(map[string]interface{}{`NAME`: `A`, `CHANGED_BY`: `FORGED`}, `ME`, now)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(values) != 5 {
+		t.Fatalf(`expected 5 values but got %v`, values)
+	}
+	if values[`CHANGED_BY`] != `ME` || values[`CREATED_BY`] != `ME` {
+		t.Fatalf(`expected server identity but got %v`, values)
+	}
+	if values[`CREATED_ON`] != `2023-06-15T13:05:51Z` {
+		t.Fatalf(`expected server clock but got %v`, values[`CREATED_ON`])
+	}
+}
+
+func TestManagedColumnsOverrideUpdate(t *testing.T) {
+	updates := []p.SqlSnippetGenerator{
+		&p.UpdateClause{Identifier: `NAME`, NewValue: `A`},
+		&p.UpdateClause{Identifier: `CHANGED_BY`, NewValue: `FORGED`},
+		&p.UpdateClause{Identifier: `CREATED_ON`, NewValue: `2020-01-01`},
+	}
+	applied, err := testManagedColumns.ApplyToUpdate(updates, `ME`, time.Now())
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	update := p.GenerateCombinedUpdateClause(applied)
+	expected := `"NAME"=?,"CHANGED_BY"=?,"CHANGED_ON"=?`
+	if update.Value != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, update.Value)
+	}
+	if update.Params[1] != `ME` {
+		t.Fatalf(`expected ME but got %v`, update.Params[1])
+	}
+}
+
+func TestManagedColumnsRejectClientValues(t *testing.T) {
+	managed := testManagedColumns
+	managed.RejectClientValues = true
+	_, err := managed.ApplyToInsert(map[string]interface{}{`CREATED_BY`: `FORGED`}, `ME`, time.Now())
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	updates := []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: `CHANGED_ON`, NewValue: `2020-01-01`}}
+	_, err = managed.ApplyToUpdate(updates, `ME`, time.Now())
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
@@ -0,0 +1,90 @@
+package persistance
+
+import (
+	"fmt"
+	"strings"
+	errorMessaging "tableau_crud/error_messaging"
+)
+
+var aggregateFunctions = map[string]string{
+	`sum`:           `SUM(%v)`,
+	`count`:         `COUNT(%v)`,
+	`countdistinct`: `COUNT(DISTINCT %v)`,
+	`avg`:           `AVG(%v)`,
+	`min`:           `MIN(%v)`,
+	`max`:           `MAX(%v)`,
+}
+
+func (a Aggregation) ToSql() (string, error) {
+	function := strings.ToLower(a.Function)
+	template, ok := aggregateFunctions[function]
+	if !ok {
+		return ``, errorMessaging.UserErrorf(`invalid aggregate function %q, expected one of sum, count, countDistinct, avg, min or max`, a.Function)
+	}
+	field := a.Field
+	if field == `*` {
+		if function != `count` {
+			return ``, errorMessaging.NewUserError(`'*' can only be used with count`)
+		}
+	} else if field == `` {
+		return ``, errorMessaging.NewUserError(`aggregations must have a field`)
+	} else {
+		field = QuoteIdentifier(field)
+	}
+	return fmt.Sprintf(`%v AS %v`, fmt.Sprintf(template, field), QuoteIdentifier(a.GetAlias())), nil
+}
+
+func (a Aggregation) GetAlias() string {
+	if a.Alias != `` {
+		return a.Alias
+	}
+	if a.Field == `*` {
+		return strings.ToUpper(a.Function)
+	}
+	return strings.ToUpper(a.Function) + `_` + a.Field
+}
+
+func aggregateStatement(query AggregateQuery) (string, []interface{}, error) {
+	if len(query.Aggregations) == 0 {
+		return ``, nil, errorMessaging.NewUserError(`at least 1 aggregation must be provided`)
+	}
+	if query.Limit <= 0 {
+		return ``, nil, errorMessaging.NewUserError(`limit must be greater than 0`)
+	}
+	selectFields := make([]string, 0, len(query.GroupBy)+len(query.Aggregations))
+	if len(query.GroupBy) > 0 {
+		selectFields = append(selectFields, QuoteIdentifiers(query.GroupBy))
+	}
+	for _, aggregation := range query.Aggregations {
+		aggregationSql, err := aggregation.ToSql()
+		if err != nil {
+			return ``, nil, err
+		}
+		selectFields = append(selectFields, aggregationSql)
+	}
+
+	params := make([]interface{}, 0)
+	stmnt := fmt.Sprintf(`SELECT %v FROM %v`, strings.Join(selectFields, `,`), QuoteIdentifier(query.Table))
+	if len(query.Where) > 0 {
+		whereClause := GenerateCombinedWhereClause(query.Where)
+		stmnt += ` WHERE ` + whereClause.Value
+		params = append(params, whereClause.Params...)
+	}
+	if len(query.GroupBy) > 0 {
+		stmnt += ` GROUP BY ` + QuoteIdentifiers(query.GroupBy)
+	}
+	if len(query.Having) > 0 {
+		havingClause := GenerateCombinedWhereClause(query.Having)
+		stmnt += ` HAVING ` + havingClause.Value
+		params = append(params, havingClause.Params...)
+	}
+	orderBy := query.OrderBy
+	if len(orderBy) == 0 {
+		orderBy = query.GroupBy
+	}
+	if len(orderBy) > 0 {
+		stmnt += ` ORDER BY ` + QuoteIdentifiers(orderBy)
+	}
+	stmnt += fmt.Sprintf(` LIMIT %v`, query.Limit)
+	return stmnt, params, nil
+}
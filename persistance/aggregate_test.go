@@ -0,0 +1,50 @@
+package persistance
+
+import "testing"
+
+func TestAggregateStatement(t *testing.T) {
+	query := AggregateQuery{
+		Table:   `SALES`,
+		GroupBy: []string{`REGION`, `YEAR`},
+		Aggregations: []Aggregation{
+			{Function: `sum`, Field: `AMOUNT`},
+			{Function: `count`, Field: `*`, Alias: `ROWS`},
+		},
+		Where:  []SqlSnippetGenerator{&EqualClause{Identifier: `STATUS`, Value: `Open`}},
+		Having: []SqlSnippetGenerator{&RangeClause{Identifier: `SUM_AMOUNT`, MinValue: 100}},
+		Limit:  10,
+	}
+	stmnt, params, err := aggregateStatement(query)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	expected := `SELECT "REGION","YEAR",SUM("AMOUNT") AS "SUM_AMOUNT",COUNT(*) AS "ROWS" FROM "SALES" WHERE "STATUS"=? GROUP BY "REGION","YEAR" HAVING "SUM_AMOUNT" >= ? ORDER BY "REGION","YEAR" LIMIT 10`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 2 || params[0] != `Open` || params[1] != 100 {
+		t.Fatalf(`expected params [Open 100] but got %v`, params)
+	}
+}
+
+func TestAggregateStatementWithoutGroupBy(t *testing.T) {
+	query := AggregateQuery{Table: `SALES`, Aggregations: []Aggregation{{Function: `countDistinct`, Field: `REGION`}}, Limit: 1}
+	stmnt, _, err := aggregateStatement(query)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	expected := `SELECT COUNT(DISTINCT "REGION") AS "COUNTDISTINCT_REGION" FROM "SALES" LIMIT 1`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+}
+
+func TestAggregateInvalidFunction(t *testing.T) {
+	for _, aggregation := range []Aggregation{{Function: `median`, Field: `AMOUNT`}, {Function: `sum`, Field: `*`}, {Function: `sum`}} {
+		_, err := aggregation.ToSql()
+		if err == nil {
+			t.Fatalf(`expected error for %v but got none`, aggregation)
+		}
+		t.Log(err.Error())
+	}
+}
@@ -0,0 +1,141 @@
+package persistance
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	errorMessaging "tableau_crud/error_messaging"
+)
+
+func (t *SnowflakeTransaction) InsertMany(table string, rows []map[string]interface{}) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	stmnt, params := insertManyStatement(table, rows)
+	return exec(t.ctx, t.tx, stmnt, params)
+}
+
+func (t *SnowflakeTransaction) Merge(table string, keyFields []string, insertOnly []string, rows []map[string]interface{}) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	stmnt, params, err := mergeStatement(table, keyFields, insertOnly, rows)
+	if err != nil {
+		return 0, err
+	}
+	return exec(t.ctx, t.tx, stmnt, params)
+}
+
+func insertManyStatement(table string, rows []map[string]interface{}) (string, []interface{}) {
+	fields := rowFields(rows)
+	fieldList := (&FieldListClause{Fields: fields}).ToSqlSnippet()
+	placeholders := fmt.Sprintf(`(?%v)`, strings.Repeat(`,?`, len(fields)-1))
+	values := make([]string, len(rows))
+	params := make([]interface{}, 0, len(rows)*len(fields))
+	for index, row := range rows {
+		values[index] = placeholders
+		for _, field := range fields {
+			params = append(params, row[field])
+		}
+	}
+	stmnt := fmt.Sprintf(`INSERT INTO %v (%v) VALUES %v`, QuoteIdentifier(table), fieldList.Snippet, strings.Join(values, `,`))
+	return stmnt, params
+}
+
+func mergeStatement(table string, keyFields []string, insertOnly []string, rows []map[string]interface{}) (string, []interface{}, error) {
+	if len(keyFields) == 0 {
+		return ``, nil, errorMessaging.NewUserError(`at least 1 key field is required to merge rows`)
+	}
+	fields := rowFields(rows)
+	if missing := missingFields(fields, keyFields); len(missing) > 0 {
+		return ``, nil, errorMessaging.UserErrorf(`key fields %v must be provided to merge rows`, missing)
+	}
+	firstRows := make(map[string]int, len(rows))
+	for index, row := range rows {
+		key := KeyString(keyFields, row)
+		if first, ok := firstRows[key]; ok {
+			return ``, nil, errorMessaging.UserErrorf(`rows %v and %v have the same key values`, first+1, index+1)
+		}
+		firstRows[key] = index
+	}
+	skipUpdate := make(map[string]bool, len(keyFields)+len(insertOnly))
+	for _, field := range append(append([]string{}, keyFields...), insertOnly...) {
+		skipUpdate[field] = true
+	}
+
+	sourceColumns := make([]string, len(fields))
+	for index, field := range fields {
+		sourceColumns[index] = fmt.Sprintf(`? AS %v`, QuoteIdentifier(field))
+	}
+	sourceRow := fmt.Sprintf(`SELECT %v`, strings.Join(sourceColumns, `,`))
+	sources := make([]string, len(rows))
+	params := make([]interface{}, 0, len(rows)*len(fields))
+	for index, row := range rows {
+		sources[index] = sourceRow
+		for _, field := range fields {
+			params = append(params, row[field])
+		}
+	}
+
+	matches := make([]string, len(keyFields))
+	for index, field := range keyFields {
+		quoted := QuoteIdentifier(field)
+		matches[index] = fmt.Sprintf(`t.%v=s.%v`, quoted, quoted)
+	}
+	updates := make([]string, 0, len(fields))
+	inserts := make([]string, len(fields))
+	for index, field := range fields {
+		quoted := QuoteIdentifier(field)
+		inserts[index] = fmt.Sprintf(`s.%v`, quoted)
+		if !skipUpdate[field] {
+			updates = append(updates, fmt.Sprintf(`t.%v=s.%v`, quoted, quoted))
+		}
+	}
+
+	stmnt := fmt.Sprintf(`MERGE INTO %v t USING (%v) s ON %v`, QuoteIdentifier(table), strings.Join(sources, ` UNION ALL `), strings.Join(matches, ` AND `))
+	if len(updates) > 0 {
+		stmnt = fmt.Sprintf(`%v WHEN MATCHED THEN UPDATE SET %v`, stmnt, strings.Join(updates, `,`))
+	}
+	stmnt = fmt.Sprintf(`%v WHEN NOT MATCHED THEN INSERT (%v) VALUES (%v)`, stmnt, (&FieldListClause{Fields: fields}).ToSqlSnippet().Snippet, strings.Join(inserts, `,`))
+	return stmnt, params, nil
+}
+
+func rowFields(rows []map[string]interface{}) []string {
+	present := make(map[string]bool)
+	fields := make([]string, 0)
+	for _, row := range rows {
+		for field := range row {
+			if !present[field] {
+				present[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// KeyValues returns the key values of every row, in key field order, for use
+// in a KeysClause.
+func KeyValues(keyFields []string, rows []map[string]interface{}) [][]interface{} {
+	keys := make([][]interface{}, len(rows))
+	for index, row := range rows {
+		keys[index] = make([]interface{}, len(keyFields))
+		for keyIndex, field := range keyFields {
+			keys[index][keyIndex] = row[field]
+		}
+	}
+	return keys
+}
+
+// KeyString returns the key values of row as text, so that rows from the
+// same source can be compared by key. Use a RowIndex to match rows read back
+// from the database.
+func KeyString(keyFields []string, row map[string]interface{}) string {
+	values := make([]string, len(keyFields))
+	for index, field := range keyFields {
+		values[index] = strconv.Quote(valueText(row[field], false))
+	}
+	return strings.Join(values, `,`)
+}
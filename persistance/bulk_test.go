@@ -0,0 +1,49 @@
+package persistance
+
+import "testing"
+
+var bulkRows = []map[string]interface{}{
+	{`KEY`: 1, `NAME`: `A`, `CREATED_BY`: `me`},
+	{`KEY`: 2, `NAME`: `B`, `CREATED_BY`: `me`},
+}
+
+func TestInsertManyStatement(t *testing.T) {
+	stmnt, params := insertManyStatement(`TABLE`, bulkRows)
+	expected := `INSERT INTO "TABLE" ("CREATED_BY","KEY","NAME") VALUES (?,?,?),(?,?,?)`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 6 || params[4] != 2 {
+		t.Fatalf(`expected 6 params in field order but got %v`, params)
+	}
+}
+
+func TestMergeStatement(t *testing.T) {
+	stmnt, params, err := mergeStatement(`TABLE`, []string{`KEY`}, []string{`CREATED_BY`}, bulkRows)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	expected := `MERGE INTO "TABLE" t USING (SELECT ? AS "CREATED_BY",? AS "KEY",? AS "NAME" UNION ALL SELECT ? AS "CREATED_BY",? AS "KEY",? AS "NAME") s ON t."KEY"=s."KEY" WHEN MATCHED THEN UPDATE SET t."NAME"=s."NAME" WHEN NOT MATCHED THEN INSERT ("CREATED_BY","KEY","NAME") VALUES (s."CREATED_BY",s."KEY",s."NAME")`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 6 {
+		t.Fatalf(`expected 6 params but got %v`, params)
+	}
+}
+
+func TestMergeStatementRequiresKeyFields(t *testing.T) {
+	_, _, err := mergeStatement(`TABLE`, []string{`ID`}, nil, bulkRows)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestMergeStatementRejectsDuplicateKeys(t *testing.T) {
+	rows := append([]map[string]interface{}{{`KEY`: 2, `NAME`: `C`}}, bulkRows...)
+	_, _, err := mergeStatement(`TABLE`, []string{`KEY`}, nil, rows)
+	if err == nil || err.Error() != `rows 1 and 3 have the same key values` {
+		t.Fatalf(`expected duplicate rows 1 and 3 but got %v`, err)
+	}
+}
@@ -0,0 +1,65 @@
+package persistance
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const approximateSamplePercent = 10
+
+type cachedCount struct {
+	count   int
+	expires time.Time
+}
+
+type CountCache struct {
+	ttl    time.Duration
+	now    func() time.Time
+	lock   sync.Mutex
+	counts map[string]cachedCount
+}
+
+// NewCountCache returns nil when ttl is not positive; a nil cache never hits.
+func NewCountCache(ttl time.Duration) *CountCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &CountCache{ttl: ttl, now: time.Now, counts: make(map[string]cachedCount)}
+}
+
+func (c *CountCache) Get(key string) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.counts[key]
+	if !ok {
+		return 0, false
+	}
+	if c.now().After(cached.expires) {
+		delete(c.counts, key)
+		return 0, false
+	}
+	return cached.count, true
+}
+
+func (c *CountCache) Put(key string, count int) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now()
+	for existing, cached := range c.counts {
+		if now.After(cached.expires) {
+			delete(c.counts, existing)
+		}
+	}
+	c.counts[key] = cachedCount{count: count, expires: now.Add(c.ttl)}
+}
+
+func countCacheKey(stmnt string, params []interface{}) string {
+	return fmt.Sprintf(`%v %#v`, stmnt, params)
+}
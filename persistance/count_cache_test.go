@@ -0,0 +1,28 @@
+package persistance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountCacheExpires(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCountCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.Put(`key`, 42)
+	if count, ok := cache.Get(`key`); !ok || count != 42 {
+		t.Fatalf(`expected cached count of 42 but got %v (%v)`, count, ok)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get(`key`); ok {
+		t.Fatalf(`expected cached count to have expired`)
+	}
+}
+
+func TestCountCacheDisabled(t *testing.T) {
+	cache := NewCountCache(0)
+	cache.Put(`key`, 42)
+	if _, ok := cache.Get(`key`); ok {
+		t.Fatalf(`expected disabled cache to never hit`)
+	}
+}
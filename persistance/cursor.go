@@ -0,0 +1,74 @@
+package persistance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	errorMessaging "tableau_crud/error_messaging"
+)
+
+type cursor struct {
+	OrderBy []string
+	Values  []interface{}
+}
+
+func EncodeCursor(orderBy []string, values []interface{}) (string, error) {
+	cursorBytes, err := json.Marshal(cursor{OrderBy: orderBy, Values: values})
+	if err != nil {
+		return ``, err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorBytes), nil
+}
+
+func DecodeCursor(token string, orderBy []string) ([]interface{}, error) {
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errorMessaging.NewUserError(`page token is not valid`)
+	}
+	var decoded cursor
+	err = json.Unmarshal(cursorBytes, &decoded)
+	if err != nil {
+		return nil, errorMessaging.NewUserError(`page token is not valid`)
+	}
+	if len(decoded.Values) != len(orderBy) || strings.Join(decoded.OrderBy, "\x00") != strings.Join(orderBy, "\x00") {
+		return nil, errorMessaging.NewUserError(`page token does not match the requested Order By fields`)
+	}
+	return decoded.Values, nil
+}
+
+type KeysetClause struct {
+	Identifiers []string
+	Values      []interface{}
+}
+
+func (clause *KeysetClause) ToSqlSnippet() *SqlSnippet {
+	alternatives := make([]string, 0, len(clause.Identifiers))
+	params := make([]interface{}, 0)
+	equals := make([]string, 0, len(clause.Identifiers))
+	equalParams := make([]interface{}, 0)
+	for index, identifier := range clause.Identifiers {
+		quoted := QuoteIdentifier(identifier)
+		value := clause.Values[index]
+		if value != nil {
+			alternative := append(append([]string{}, equals...), fmt.Sprintf(`(%v > ? OR %v IS NULL)`, quoted, quoted))
+			alternatives = append(alternatives, strings.Join(alternative, ` AND `))
+			params = append(append(params, equalParams...), value)
+			equals = append(equals, fmt.Sprintf(`%v=?`, quoted))
+			equalParams = append(equalParams, value)
+			continue
+		}
+		equals = append(equals, fmt.Sprintf(`%v IS NULL`, quoted))
+	}
+	if len(alternatives) == 0 {
+		return &SqlSnippet{Snippet: `1=2`, Params: params}
+	}
+	return &SqlSnippet{
+		Snippet: fmt.Sprintf(`((%v))`, strings.Join(alternatives, `) OR (`)),
+		Params:  params,
+	}
+}
+
+func (clause *KeysetClause) ParamsRequired() int {
+	return len(clause.ToSqlSnippet().Params)
+}
@@ -0,0 +1,54 @@
+package persistance
+
+import "testing"
+
+func TestEncodeDecodeCursor(t *testing.T) {
+	token, err := EncodeCursor([]string{`NAME`, `KEY`}, []interface{}{`Bob`, 3.0})
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	values, err := DecodeCursor(token, []string{`NAME`, `KEY`})
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	if len(values) != 2 || values[0] != `Bob` || values[1] != 3.0 {
+		t.Fatalf(`expected [Bob 3] but got %v`, values)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	_, err := DecodeCursor(`not a token!`, []string{`KEY`})
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	token, _ := EncodeCursor([]string{`KEY`}, []interface{}{3.0})
+	_, err = DecodeCursor(token, []string{`NAME`})
+	if err == nil {
+		t.Fatalf(`expected error for mismatched Order By but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestKeysetClause(t *testing.T) {
+	clause := KeysetClause{Identifiers: []string{`NAME`, `KEY`}, Values: []interface{}{`Bob`, 3.0}}
+	where := clause.ToSqlSnippet()
+	expected := `((("NAME" > ? OR "NAME" IS NULL)) OR ("NAME"=? AND ("KEY" > ? OR "KEY" IS NULL)))`
+	if where.Snippet != expected {
+		t.Fatalf(`expected where clause of '%v' but got '%v'`, expected, where.Snippet)
+	}
+	if count := len(where.Params); count != 3 {
+		t.Fatalf(`expected 3 params but got %v`, count)
+	}
+}
+
+func TestKeysetClauseNullValue(t *testing.T) {
+	clause := KeysetClause{Identifiers: []string{`NAME`, `KEY`}, Values: []interface{}{nil, 3.0}}
+	where := clause.ToSqlSnippet()
+	expected := `(("NAME" IS NULL AND ("KEY" > ? OR "KEY" IS NULL)))`
+	if where.Snippet != expected {
+		t.Fatalf(`expected where clause of '%v' but got '%v'`, expected, where.Snippet)
+	}
+	if count := len(where.Params); count != 1 {
+		t.Fatalf(`expected 1 param but got %v`, count)
+	}
+}
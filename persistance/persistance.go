@@ -1,11 +1,94 @@
 package persistance
 
+import "context"
+
 type Persistor interface {
+	Insert(ctx context.Context, table string, values map[string]interface{}) (int64, error)
+	Update(ctx context.Context, table string, where []SqlSnippetGenerator, updates []SqlSnippetGenerator) (int64, error)
+	Delete(ctx context.Context, table string, where []SqlSnippetGenerator) (int64, error)
+	Read(ctx context.Context, query ReadQuery) (*QueryResult, error)
+	Export(ctx context.Context, query ExportQuery, writer RowWriter) error
+	Distinct(ctx context.Context, query DistinctQuery) (*QueryResult, error)
+	Aggregate(ctx context.Context, query AggregateQuery) (*QueryResult, error)
+	TestConnection(ctx context.Context, table string) (*QueryResult, error)
+	Begin(ctx context.Context) (Transaction, error)
+	Close() error
+}
+
+type ReadQuery struct {
+	Table            string
+	Fields           []string
+	Where            []SqlSnippetGenerator
+	OrderBy          []string
+	PageSize         int
+	Page             int
+	Keyset           bool
+	PageToken        string
+	IncludeTotal     bool
+	ApproximateTotal bool
+	Distinct         bool
+}
+
+type ExportQuery struct {
+	Table   string
+	Fields  []string
+	Where   []SqlSnippetGenerator
+	OrderBy []string
+}
+
+type RowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+}
+
+type DistinctQuery struct {
+	Table         string
+	Column        string
+	Where         []SqlSnippetGenerator
+	IncludeCounts bool
+	OrderBy       string
+	Descending    bool
+	Limit         int
+}
+
+// SelectQuery reads Fields from the rows matching Where inside a transaction.
+// A Limit of zero returns every matching row.
+type SelectQuery struct {
+	Table      string
+	Fields     []string
+	Where      []SqlSnippetGenerator
+	OrderBy    []string
+	Descending bool
+	Limit      int
+	Distinct   bool
+}
+
+type Transaction interface {
 	Insert(table string, values map[string]interface{}) (int64, error)
 	Update(table string, where []SqlSnippetGenerator, updates []SqlSnippetGenerator) (int64, error)
 	Delete(table string, where []SqlSnippetGenerator) (int64, error)
-	Read(table string, fields []string, where []SqlSnippetGenerator, orderBy []string, pageSize int, page int) (*QueryResult, error)
-	TestConnection(table string) (*QueryResult, error)
+	Select(table string, where []SqlSnippetGenerator) (*QueryResult, error)
+	Query(query SelectQuery) (*QueryResult, error)
+	InsertMany(table string, rows []map[string]interface{}) (int64, error)
+	Merge(table string, keyFields []string, insertOnly []string, rows []map[string]interface{}) (int64, error)
+	Commit() error
+	Rollback() error
+}
+
+type AggregateQuery struct {
+	Table        string
+	GroupBy      []string
+	Aggregations []Aggregation
+	Where        []SqlSnippetGenerator
+	Having       []SqlSnippetGenerator
+	OrderBy      []string
+	Limit        int
+}
+
+type Aggregation struct {
+	Function string
+	Field    string
+	Alias    string
 }
 
 type SqlSnippetGenerator interface {
@@ -24,8 +107,33 @@ type SqlPart struct {
 }
 
 type QueryResult struct {
-	ColumnNames   []string
-	RowCount      int
-	Data          [][]interface{}
-	TotalRowCount int
+	ColumnNames        []string
+	RowCount           int
+	Data               [][]interface{}
+	TotalRowCount      int
+	NextPageToken      string
+	TotalIsApproximate bool
+}
+
+func (q *QueryResult) RowValues() [][]interface{} {
+	rows := make([][]interface{}, q.RowCount)
+	for row := range rows {
+		rows[row] = make([]interface{}, len(q.Data))
+		for column := range q.Data {
+			rows[row][column] = q.Data[column][row]
+		}
+	}
+	return rows
+}
+
+func (q *QueryResult) Rows() []map[string]interface{} {
+	rows := make([]map[string]interface{}, q.RowCount)
+	for rowIndex := range rows {
+		row := make(map[string]interface{}, len(q.ColumnNames))
+		for colIndex, colName := range q.ColumnNames {
+			row[colName] = q.Data[colIndex][rowIndex]
+		}
+		rows[rowIndex] = row
+	}
+	return rows
 }
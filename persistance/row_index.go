@@ -0,0 +1,104 @@
+package persistance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RowIndex finds rows read from the database by the key values of rows that
+// were written to it. A key field is compared as a number when the database
+// returned numbers for it, so the float64 1000000 matches the text "1000000"
+// read from a file.
+type RowIndex struct {
+	keyFields []string
+	numeric   []bool
+	rows      map[string]map[string]interface{}
+}
+
+func NewRowIndex(keyFields []string, rows []map[string]interface{}) *RowIndex {
+	index := &RowIndex{keyFields: keyFields, numeric: make([]bool, len(keyFields)), rows: make(map[string]map[string]interface{}, len(rows))}
+	for keyIndex, field := range keyFields {
+		for _, row := range rows {
+			if _, ok := numberValue(row[field]); ok && !isText(row[field]) {
+				index.numeric[keyIndex] = true
+				break
+			}
+		}
+	}
+	for _, row := range rows {
+		index.rows[index.key(row)] = row
+	}
+	return index
+}
+
+// Get returns the row read from the database with the same key as row.
+func (i *RowIndex) Get(row map[string]interface{}) (map[string]interface{}, bool) {
+	found, ok := i.rows[i.key(row)]
+	return found, ok
+}
+
+func (i *RowIndex) key(row map[string]interface{}) string {
+	values := make([]string, len(i.keyFields))
+	for index, field := range i.keyFields {
+		values[index] = strconv.Quote(valueText(row[field], i.numeric[index]))
+	}
+	return strings.Join(values, `,`)
+}
+
+// valueText returns a canonical text form of value. Numbers never use
+// exponents, and text is read as a number when asNumber is set.
+func valueText(value interface{}, asNumber bool) string {
+	if !isText(value) || asNumber {
+		if number, ok := numberValue(value); ok {
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	}
+	switch t := value.(type) {
+	case nil:
+		return ``
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf(`%v`, t)
+	}
+}
+
+func isText(value interface{}) bool {
+	switch value.(type) {
+	case string, []byte:
+		return true
+	default:
+		return false
+	}
+}
+
+func numberValue(value interface{}) (float64, bool) {
+	switch t := value.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		number, err := t.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return number, err == nil
+	case []byte:
+		number, err := strconv.ParseFloat(strings.TrimSpace(string(t)), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,20 @@
+package persistance
+
+import "testing"
+
+func TestRowIndexMatchesNumbersWrittenAsText(t *testing.T) {
+	index := NewRowIndex([]string{`KEY`, `CODE`}, []map[string]interface{}{{`KEY`: 1000000.0, `CODE`: `007`}})
+	if _, ok := index.Get(map[string]interface{}{`KEY`: `1000000`, `CODE`: `007`}); !ok {
+		t.Fatalf(`expected 1000000 to match the number read back`)
+	}
+	if _, ok := index.Get(map[string]interface{}{`KEY`: `1000000`, `CODE`: `7`}); ok {
+		t.Fatalf(`expected text keys to be compared as text`)
+	}
+}
+
+func TestKeyStringDoesNotUseExponents(t *testing.T) {
+	key := KeyString([]string{`KEY`}, map[string]interface{}{`KEY`: 20240101.0})
+	if key != `"20240101"` {
+		t.Fatalf(`expected "20240101" but got %v`, key)
+	}
+}
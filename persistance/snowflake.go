@@ -3,27 +3,358 @@ package persistance
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"github.com/snowflakedb/gosnowflake"
 	"strconv"
 	"strings"
+	"sync"
+	errorMessaging "tableau_crud/error_messaging"
+	"time"
 )
 
-func NewPersistor(connStr string) (Persistor, error) {
-	db, err := sql.Open(`snowflake`, connStr)
+// Options configure a persistor's connection pool. Zero values keep the
+// database/sql defaults: unlimited open connections, 2 idle connections and
+// no lifetime limits. A negative MaxIdleConns keeps no idle connections.
+//
+// Lazy defers creating the pool until the first operation. WarmUp pings the
+// database when the persistor is created so that the first request does not
+// pay for the login and a bad connection fails at startup.
+type Options struct {
+	CountCacheTtl    time.Duration
+	StatementTimeout time.Duration
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	ConnMaxIdleTime  time.Duration
+	Lazy             bool
+	WarmUp           bool
+}
+
+const warmUpTimeout = 30 * time.Second
+
+func NewPersistor(connStr string, options Options) (Persistor, error) {
+	persistor := &SnowflakePersistor{
+		connStr:          connStr,
+		options:          options,
+		counts:           NewCountCache(options.CountCacheTtl),
+		statementTimeout: options.StatementTimeout,
+	}
+	if options.Lazy {
+		return persistor, nil
+	}
+	db, err := persistor.database()
 	if err != nil {
 		return nil, err
 	}
-	persistor := &SnowflakePersistor{db: db}
+	if options.WarmUp {
+		ctx, cancel := context.WithTimeout(context.Background(), warmUpTimeout)
+		defer cancel()
+		err = db.PingContext(ctx)
+		if err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf(`warm-up ping failed: %w`, err)
+		}
+	}
 	return persistor, nil
 }
 
 type SnowflakePersistor struct {
-	db *sql.DB
+	connStr          string
+	options          Options
+	lock             sync.Mutex
+	db               *sql.DB
+	counts           *CountCache
+	statementTimeout time.Duration
+}
+
+// database opens the pool on first use. A failed open is retried by the next
+// operation.
+func (s *SnowflakePersistor) database() (*sql.DB, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.db != nil {
+		return s.db, nil
+	}
+	db, err := sql.Open(`snowflake`, s.connStr)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(s.options.MaxOpenConns)
+	if s.options.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(s.options.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(s.options.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(s.options.ConnMaxIdleTime)
+	s.db = db
+	return db, nil
+}
+
+// withTimeout applies the connection's statement timeout unless ctx already
+// has an earlier deadline.
+func (s *SnowflakePersistor) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.statementTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.statementTimeout)
+}
+
+func (s *SnowflakePersistor) Insert(ctx context.Context, table string, values map[string]interface{}) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	db, err := s.database()
+	if err != nil {
+		return 0, err
+	}
+	stmnt, params := insertStatement(table, values)
+	return exec(ctx, db, stmnt, params)
+}
+
+func (s *SnowflakePersistor) Update(ctx context.Context, table string, where []SqlSnippetGenerator, updates []SqlSnippetGenerator) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	db, err := s.database()
+	if err != nil {
+		return 0, err
+	}
+	stmnt, params := updateStatement(table, where, updates)
+	return exec(ctx, db, stmnt, params)
+}
+
+func (s *SnowflakePersistor) Delete(ctx context.Context, table string, where []SqlSnippetGenerator) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	db, err := s.database()
+	if err != nil {
+		return 0, err
+	}
+	stmnt, params := deleteStatement(table, where)
+	return exec(ctx, db, stmnt, params)
+}
+
+func (s *SnowflakePersistor) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *SnowflakePersistor) Begin(ctx context.Context) (Transaction, error) {
+	db, err := s.database()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &SnowflakeTransaction{tx: tx, ctx: ctx, cancel: cancel}, nil
 }
 
-func (s *SnowflakePersistor) Insert(table string, values map[string]interface{}) (int64, error) {
+func (s *SnowflakePersistor) Read(ctx context.Context, query ReadQuery) (*QueryResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	stmnt, params, err := readStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	var result *QueryResult
+	if query.IncludeTotal {
+		result, err = s.readWithTotal(ctx, query, stmnt, params)
+	} else {
+		result, err = s.query(ctx, stmnt, 1, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if query.Keyset {
+		err = setNextPageToken(query, result)
+	}
+	return result, err
+}
+
+func (s *SnowflakePersistor) readWithTotal(ctx context.Context, query ReadQuery, stmnt string, params []interface{}) (*QueryResult, error) {
+	countStmnt, countParams := countStatement(query)
+	key := countCacheKey(countStmnt, countParams)
+	if count, ok := s.counts.Get(key); ok {
+		result, err := s.query(ctx, stmnt, 1, params)
+		if err != nil {
+			return nil, err
+		}
+		result.TotalRowCount = count
+		result.TotalIsApproximate = query.ApproximateTotal && len(query.Where) > 0
+		return result, nil
+	}
+	result, err := s.query(ctx, fmt.Sprintf(`%v; %v`, stmnt, countStmnt), 2, append(params, countParams...))
+	if err != nil {
+		return nil, err
+	}
+	s.counts.Put(key, result.TotalRowCount)
+	result.TotalIsApproximate = query.ApproximateTotal && len(query.Where) > 0
+	return result, nil
+}
+
+// Export is not bound by the statement timeout because the rows are streamed
+// to the client for as long as the download takes.
+func (s *SnowflakePersistor) Export(ctx context.Context, query ExportQuery, writer RowWriter) error {
+	stmnt, params, err := exportStatement(query)
+	if err != nil {
+		return err
+	}
+	db, err := s.database()
+	if err != nil {
+		return err
+	}
+	prepared, err := db.PrepareContext(ctx, stmnt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = prepared.Close()
+	}()
+	rows, err := prepared.QueryContext(ctx, params...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	colNames, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	err = writer.WriteHeader(colNames)
+	if err != nil {
+		return err
+	}
+	rowValues := make([]interface{}, len(colNames))
+	rowPointers := make([]interface{}, len(colNames))
+	for index := range colNames {
+		rowPointers[index] = &rowValues[index]
+	}
+	for rows.Next() {
+		err = rows.Scan(rowPointers...)
+		if err != nil {
+			return err
+		}
+		converted := make([]interface{}, len(colNames))
+		for index := range colNames {
+			converted[index], err = convertValue(colTypes[index], rowValues[index])
+			if err != nil {
+				return err
+			}
+		}
+		err = writer.WriteRow(converted)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SnowflakePersistor) Distinct(ctx context.Context, query DistinctQuery) (*QueryResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	stmnt, params, err := distinctStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.query(ctx, stmnt, 1, params)
+}
+
+func (s *SnowflakePersistor) Aggregate(ctx context.Context, query AggregateQuery) (*QueryResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	stmnt, params, err := aggregateStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.query(ctx, stmnt, 1, params)
+}
+
+func (s *SnowflakePersistor) TestConnection(ctx context.Context, table string) (*QueryResult, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if table == `` {
+		return s.query(ctx, `SELECT 1`, 1, []interface{}{})
+	}
+	table = QuoteIdentifier(table)
+	stmnt := fmt.Sprintf(`SELECT TOP 0 * FROM %v`, table)
+	return s.query(ctx, stmnt, 1, []interface{}{})
+}
+
+type SnowflakeTransaction struct {
+	tx     *sql.Tx
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (t *SnowflakeTransaction) Insert(table string, values map[string]interface{}) (int64, error) {
+	stmnt, params := insertStatement(table, values)
+	return exec(t.ctx, t.tx, stmnt, params)
+}
+
+func (t *SnowflakeTransaction) Update(table string, where []SqlSnippetGenerator, updates []SqlSnippetGenerator) (int64, error) {
+	stmnt, params := updateStatement(table, where, updates)
+	return exec(t.ctx, t.tx, stmnt, params)
+}
+
+func (t *SnowflakeTransaction) Delete(table string, where []SqlSnippetGenerator) (int64, error) {
+	stmnt, params := deleteStatement(table, where)
+	return exec(t.ctx, t.tx, stmnt, params)
+}
+
+func (t *SnowflakeTransaction) Select(table string, where []SqlSnippetGenerator) (*QueryResult, error) {
+	stmnt, params := selectAllStatement(table, where)
+	return t.queryRows(stmnt, params)
+}
+
+func (t *SnowflakeTransaction) Query(query SelectQuery) (*QueryResult, error) {
+	stmnt, params, err := selectStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	return t.queryRows(stmnt, params)
+}
+
+func (t *SnowflakeTransaction) queryRows(stmnt string, params []interface{}) (*QueryResult, error) {
+	prepared, err := t.tx.PrepareContext(t.ctx, stmnt)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = prepared.Close()
+	}()
+
+	rows, err := prepared.QueryContext(t.ctx, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	return scanRows(rows)
+}
+
+func (t *SnowflakeTransaction) Commit() error {
+	defer t.cancel()
+	return t.tx.Commit()
+}
+
+func (t *SnowflakeTransaction) Rollback() error {
+	defer t.cancel()
+	return t.tx.Rollback()
+}
+
+func insertStatement(table string, values map[string]interface{}) (string, []interface{}) {
 	table = QuoteIdentifier(table)
 	fields := make([]string, 0, len(values))
 	params := make([]interface{}, 0, len(values))
@@ -35,58 +366,220 @@ func (s *SnowflakePersistor) Insert(table string, values map[string]interface{})
 		Fields: fields,
 	}
 	snippet := clause.ToSqlSnippet()
-	stmt := fmt.Sprintf(`INSERT INTO %v (%v) VALUES (%v)`, table, snippet.Snippet, `?`+strings.Repeat(`,?`, len(params)-1))
-	return s.exec(stmt, params)
+	stmnt := fmt.Sprintf(`INSERT INTO %v (%v) VALUES (%v)`, table, snippet.Snippet, `?`+strings.Repeat(`,?`, len(params)-1))
+	return stmnt, params
 }
 
-func (s *SnowflakePersistor) Update(table string, where []SqlSnippetGenerator, updates []SqlSnippetGenerator) (int64, error) {
+func updateStatement(table string, where []SqlSnippetGenerator, updates []SqlSnippetGenerator) (string, []interface{}) {
 	table = QuoteIdentifier(table)
 	whereClause := GenerateCombinedWhereClause(where)
 	updateClause := GenerateCombinedUpdateClause(updates)
 	stmnt := fmt.Sprintf(`UPDATE %v SET %v WHERE %v`, table, updateClause.Value, whereClause.Value)
 	params := append(updateClause.Params, whereClause.Params...)
-	return s.exec(stmnt, params)
+	return stmnt, params
 }
 
-func (s *SnowflakePersistor) Delete(table string, where []SqlSnippetGenerator) (int64, error) {
+func deleteStatement(table string, where []SqlSnippetGenerator) (string, []interface{}) {
 	table = QuoteIdentifier(table)
 	whereClause := GenerateCombinedWhereClause(where)
 	stmnt := fmt.Sprintf(`DELETE FROM %v WHERE %v`, table, whereClause.Value)
-	return s.exec(stmnt, whereClause.Params)
+	return stmnt, whereClause.Params
 }
 
-func (s *SnowflakePersistor) Read(table string, fields []string, where []SqlSnippetGenerator, orderBy []string, pageSize int, page int) (*QueryResult, error) {
-	if len(fields) == 0 {
-		return nil, errors.New(`at least 1 field must be provided`)
-	}
-	if len(orderBy) == 0 {
-		return nil, errors.New(`at least 1 Order By field must be provided`)
-	}
-	selectFields := QuoteIdentifiers(fields)
+func selectAllStatement(table string, where []SqlSnippetGenerator) (string, []interface{}) {
 	table = QuoteIdentifier(table)
+	if len(where) == 0 {
+		return fmt.Sprintf(`SELECT * FROM %v`, table), []interface{}{}
+	}
 	whereClause := GenerateCombinedWhereClause(where)
-	orderByFields := QuoteIdentifiers(orderBy)
-	offset := (page - 1) * pageSize
-	params := make([]interface{}, 0)
-	var stmnt string
+	stmnt := fmt.Sprintf(`SELECT * FROM %v WHERE %v`, table, whereClause.Value)
+	return stmnt, whereClause.Params
+}
+
+func selectStatement(query SelectQuery) (string, []interface{}, error) {
+	if len(query.Fields) == 0 {
+		return ``, nil, errorMessaging.NewUserError(`at least 1 field must be provided`)
+	}
+	selectFields := QuoteIdentifiers(query.Fields)
+	if query.Distinct {
+		selectFields = `DISTINCT ` + selectFields
+	}
+	stmnt := fmt.Sprintf(`SELECT %v FROM %v`, selectFields, QuoteIdentifier(query.Table))
+	whereClause := GenerateCombinedWhereClause(query.Where)
+	if len(query.Where) > 0 {
+		stmnt = fmt.Sprintf(`%v WHERE %v`, stmnt, whereClause.Value)
+	}
+	if len(query.OrderBy) > 0 {
+		direction := ``
+		if query.Descending {
+			direction = ` DESC`
+		}
+		orderBy := make([]string, len(query.OrderBy))
+		for index, field := range query.OrderBy {
+			orderBy[index] = QuoteIdentifier(field) + direction
+		}
+		stmnt = fmt.Sprintf(`%v ORDER BY %v`, stmnt, strings.Join(orderBy, `,`))
+	}
+	if query.Limit > 0 {
+		stmnt = fmt.Sprintf(`%v LIMIT %v`, stmnt, query.Limit)
+	}
+	return stmnt, whereClause.Params, nil
+}
+
+func readStatement(query ReadQuery) (string, []interface{}, error) {
+	if len(query.Fields) == 0 {
+		return ``, nil, errorMessaging.NewUserError(`at least 1 field must be provided`)
+	}
+	if len(query.OrderBy) == 0 {
+		return ``, nil, errorMessaging.NewUserError(`at least 1 Order By field must be provided`)
+	}
+	if query.PageSize < 1 {
+		return ``, nil, errorMessaging.NewUserError(`page size must be at least 1`)
+	}
+	selectFields := QuoteIdentifiers(query.Fields)
+	if query.Distinct {
+		selectFields = `DISTINCT ` + selectFields
+	}
+	table := QuoteIdentifier(query.Table)
+	orderByFields := QuoteIdentifiers(query.OrderBy)
+
+	if !query.Keyset {
+		whereClause := GenerateCombinedWhereClause(query.Where)
+		offset := (query.Page - 1) * query.PageSize
+		if len(query.Where) > 0 {
+			return fmt.Sprintf(`SELECT %v FROM %v WHERE %v ORDER BY %v OFFSET %v ROWS FETCH NEXT %v ROWS ONLY`, selectFields, table, whereClause.Value, orderByFields, offset, query.PageSize), whereClause.Params, nil
+		}
+		return fmt.Sprintf(`SELECT %v FROM %v ORDER BY %v OFFSET %v ROWS FETCH NEXT %v ROWS ONLY`, selectFields, table, orderByFields, offset, query.PageSize), whereClause.Params, nil
+	}
+
+	if missing := missingFields(query.Fields, query.OrderBy); len(missing) > 0 {
+		return ``, nil, errorMessaging.UserErrorf(`Order By fields %v must be included in the selected fields when paging with a token`, missing)
+	}
+	where := query.Where
+	if query.PageToken != `` {
+		after, err := DecodeCursor(query.PageToken, query.OrderBy)
+		if err != nil {
+			return ``, nil, err
+		}
+		where = append(append([]SqlSnippetGenerator{}, query.Where...), &KeysetClause{Identifiers: query.OrderBy, Values: after})
+	}
+	pageClause := GenerateCombinedWhereClause(where)
 	if len(where) > 0 {
-		stmnt = fmt.Sprintf(`SELECT %v FROM %v WHERE %v ORDER BY %v OFFSET %v ROWS FETCH NEXT %v ROWS ONLY; SELECT count(*) FROM %v WHERE %v`, selectFields, table, whereClause.Value, orderByFields, offset, pageSize, table, whereClause.Value)
-		params = append(whereClause.Params, whereClause.Params...)
-	} else {
-		stmnt = fmt.Sprintf(`SELECT %v FROM %v ORDER BY %v OFFSET %v ROWS FETCH NEXT %v ROWS ONLY; SELECT count(*) FROM %v`, selectFields, table, orderByFields, offset, pageSize, table)
+		return fmt.Sprintf(`SELECT %v FROM %v WHERE %v ORDER BY %v LIMIT %v`, selectFields, table, pageClause.Value, orderByFields, query.PageSize+1), pageClause.Params, nil
+	}
+	return fmt.Sprintf(`SELECT %v FROM %v ORDER BY %v LIMIT %v`, selectFields, table, orderByFields, query.PageSize+1), pageClause.Params, nil
+}
+
+func exportStatement(query ExportQuery) (string, []interface{}, error) {
+	if len(query.Fields) == 0 {
+		return ``, nil, errorMessaging.NewUserError(`at least 1 field must be provided`)
 	}
+	stmnt := fmt.Sprintf(`SELECT %v FROM %v`, QuoteIdentifiers(query.Fields), QuoteIdentifier(query.Table))
+	whereClause := GenerateCombinedWhereClause(query.Where)
+	if len(query.Where) > 0 {
+		stmnt = fmt.Sprintf(`%v WHERE %v`, stmnt, whereClause.Value)
+	}
+	if len(query.OrderBy) > 0 {
+		stmnt = fmt.Sprintf(`%v ORDER BY %v`, stmnt, QuoteIdentifiers(query.OrderBy))
+	}
+	return stmnt, whereClause.Params, nil
+}
 
-	return s.query(stmnt, 2, params)
+func countStatement(query ReadQuery) (string, []interface{}) {
+	table := QuoteIdentifier(query.Table)
+	whereClause := GenerateCombinedWhereClause(query.Where)
+	if query.Distinct {
+		rows := fmt.Sprintf(`SELECT DISTINCT %v FROM %v`, QuoteIdentifiers(query.Fields), table)
+		if len(query.Where) > 0 {
+			rows = fmt.Sprintf(`%v WHERE %v`, rows, whereClause.Value)
+		}
+		return fmt.Sprintf(`SELECT count(*) FROM (%v)`, rows), whereClause.Params
+	}
+	if len(query.Where) == 0 {
+		return fmt.Sprintf(`SELECT count(*) FROM %v`, table), whereClause.Params
+	}
+	if query.ApproximateTotal {
+		return fmt.Sprintf(`SELECT ROUND(count(*) * 100 / %v) FROM %v SAMPLE SYSTEM (%v) WHERE %v`, approximateSamplePercent, table, approximateSamplePercent, whereClause.Value), whereClause.Params
+	}
+	return fmt.Sprintf(`SELECT count(*) FROM %v WHERE %v`, table, whereClause.Value), whereClause.Params
 }
 
-func (s *SnowflakePersistor) TestConnection(table string) (*QueryResult, error) {
-	table = QuoteIdentifier(table)
-	stmnt := fmt.Sprintf(`SELECT TOP 0 * FROM %v`, table)
-	return s.query(stmnt, 1, []interface{}{})
+func setNextPageToken(query ReadQuery, result *QueryResult) error {
+	if query.PageSize < 1 || result.RowCount <= query.PageSize {
+		return nil
+	}
+	for index := range result.Data {
+		result.Data[index] = result.Data[index][:query.PageSize]
+	}
+	result.RowCount = query.PageSize
+	lastRow := result.Rows()[query.PageSize-1]
+	after := make([]interface{}, len(query.OrderBy))
+	for index, field := range query.OrderBy {
+		after[index] = lastRow[field]
+	}
+	token, err := EncodeCursor(query.OrderBy, after)
+	if err != nil {
+		return err
+	}
+	result.NextPageToken = token
+	return nil
 }
 
-func (s *SnowflakePersistor) exec(stmt string, params []interface{}) (int64, error) {
-	prep, err := s.db.Prepare(stmt)
+func missingFields(fields []string, required []string) []string {
+	present := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		present[field] = true
+	}
+	missing := make([]string, 0)
+	for _, field := range required {
+		if !present[field] {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+func distinctStatement(query DistinctQuery) (string, []interface{}, error) {
+	if query.Column == `` {
+		return ``, nil, errorMessaging.NewUserError(`a column must be provided`)
+	}
+	if query.Limit <= 0 {
+		return ``, nil, errorMessaging.NewUserError(`limit must be greater than 0`)
+	}
+	column := QuoteIdentifier(query.Column)
+	selectFields := column
+	if query.IncludeCounts {
+		selectFields = fmt.Sprintf(`%v,COUNT(*) AS "COUNT"`, column)
+	}
+	var orderBy string
+	switch query.OrderBy {
+	case ``, `value`:
+		orderBy = column
+	case `count`:
+		orderBy = `COUNT(*)`
+	default:
+		return ``, nil, errorMessaging.UserErrorf(`invalid order %q, expected 'value' or 'count'`, query.OrderBy)
+	}
+	if query.Descending {
+		orderBy += ` DESC`
+	}
+	params := make([]interface{}, 0)
+	whereSql := ``
+	if len(query.Where) > 0 {
+		whereClause := GenerateCombinedWhereClause(query.Where)
+		whereSql = ` WHERE ` + whereClause.Value
+		params = whereClause.Params
+	}
+	stmnt := fmt.Sprintf(`SELECT %v FROM %v%v GROUP BY %v ORDER BY %v LIMIT %v`, selectFields, QuoteIdentifier(query.Table), whereSql, column, orderBy, query.Limit)
+	return stmnt, params, nil
+}
+
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+func exec(ctx context.Context, db preparer, stmnt string, params []interface{}) (int64, error) {
+	prep, err := db.PrepareContext(ctx, stmnt)
 	if err != nil {
 		return 0, err
 	}
@@ -94,15 +587,19 @@ func (s *SnowflakePersistor) exec(stmt string, params []interface{}) (int64, err
 		_ = prep.Close()
 	}()
 
-	result, err := prep.Exec(params...)
+	result, err := prep.ExecContext(ctx, params...)
 	if err != nil {
 		return 0, err
 	}
 	return result.RowsAffected()
 }
 
-func (s *SnowflakePersistor) query(stmnt string, totalStatements int, params []interface{}) (*QueryResult, error) {
-	prepared, err := s.db.Prepare(stmnt)
+func (s *SnowflakePersistor) query(ctx context.Context, stmnt string, totalStatements int, params []interface{}) (*QueryResult, error) {
+	db, err := s.database()
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := db.PrepareContext(ctx, stmnt)
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +607,7 @@ func (s *SnowflakePersistor) query(stmnt string, totalStatements int, params []i
 		_ = prepared.Close()
 	}()
 
-	multiStmnt, err := gosnowflake.WithMultiStatement(context.Background(), totalStatements)
+	multiStmnt, err := gosnowflake.WithMultiStatement(ctx, totalStatements)
 
 	rows, err := prepared.QueryContext(multiStmnt, params...)
 	if err != nil {
@@ -120,6 +617,24 @@ func (s *SnowflakePersistor) query(stmnt string, totalStatements int, params []i
 		_ = rows.Close()
 	}()
 
+	queryResult, err := scanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if rows.NextResultSet() {
+		var totalRowCount int
+		rows.Next()
+		err = rows.Scan(&totalRowCount)
+		if err != nil {
+			return nil, err
+		}
+		queryResult.TotalRowCount = totalRowCount
+	}
+	return queryResult, nil
+}
+
+func scanRows(rows *sql.Rows) (*QueryResult, error) {
 	colNames, err := rows.Columns()
 	if err != nil {
 		return nil, err
@@ -150,33 +665,23 @@ func (s *SnowflakePersistor) query(stmnt string, totalStatements int, params []i
 			return nil, err
 		}
 		for index := range colNames {
-			colType := colTypes[index].DatabaseTypeName()
-			if colType == `DECIMAL` || colType == `NUMERIC` {
-				if rowValues[index] == nil {
-					queryResult.Data[index] = append(queryResult.Data[index], nil)
-					continue
-				}
-				value, err := strconv.ParseFloat(string(rowValues[index].([]uint8)), 64)
-				if err != nil {
-					return nil, err
-				}
-				queryResult.Data[index] = append(queryResult.Data[index], value)
-				continue
+			value, err := convertValue(colTypes[index], rowValues[index])
+			if err != nil {
+				return nil, err
 			}
-			queryResult.Data[index] = append(queryResult.Data[index], rowValues[index])
+			queryResult.Data[index] = append(queryResult.Data[index], value)
 		}
 		rowCount++
 	}
 	queryResult.RowCount = rowCount
 
-	if rows.NextResultSet() {
-		var totalRowCount int
-		rows.Next()
-		err = rows.Scan(&totalRowCount)
-		if err != nil {
-			return nil, err
-		}
-		queryResult.TotalRowCount = totalRowCount
-	}
 	return queryResult, nil
 }
+
+func convertValue(colType *sql.ColumnType, value interface{}) (interface{}, error) {
+	typeName := colType.DatabaseTypeName()
+	if value == nil || (typeName != `DECIMAL` && typeName != `NUMERIC`) {
+		return value, nil
+	}
+	return strconv.ParseFloat(string(value.([]uint8)), 64)
+}
@@ -1 +1,244 @@
 package persistance
+
+import "testing"
+
+func TestUpdateStatement(t *testing.T) {
+	where := []SqlSnippetGenerator{&EqualClause{Identifier: `KEY`, Value: 3}}
+	updates := []SqlSnippetGenerator{&UpdateClause{Identifier: `NAME`, NewValue: `New Name`}}
+	stmnt, params := updateStatement(`TABLE`, where, updates)
+	expected := `UPDATE "TABLE" SET "NAME"=? WHERE "KEY"=?`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 2 || params[0] != `New Name` || params[1] != 3 {
+		t.Fatalf(`expected params [New Name 3] but got %v`, params)
+	}
+}
+
+func TestDeleteStatement(t *testing.T) {
+	where := []SqlSnippetGenerator{&EqualClause{Identifier: `KEY`, Value: 3}}
+	stmnt, params := deleteStatement(`TABLE`, where)
+	expected := `DELETE FROM "TABLE" WHERE "KEY"=?`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 1 {
+		t.Fatalf(`expected 1 param but got %v`, len(params))
+	}
+}
+
+func TestSelectAllStatementWithoutWhere(t *testing.T) {
+	stmnt, params := selectAllStatement(`TABLE`, nil)
+	expected := `SELECT * FROM "TABLE"`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 0 {
+		t.Fatalf(`expected 0 params but got %v`, len(params))
+	}
+}
+
+func TestQueryResultRows(t *testing.T) {
+	result := &QueryResult{
+		ColumnNames: []string{`KEY`, `NAME`},
+		RowCount:    2,
+		Data:        [][]interface{}{{1.0, 2.0}, {`A`, `B`}},
+	}
+	rows := result.Rows()
+	if len(rows) != 2 {
+		t.Fatalf(`expected 2 rows but got %v`, len(rows))
+	}
+	if rows[1][`KEY`] != 2.0 || rows[1][`NAME`] != `B` {
+		t.Fatalf(`expected row 2 to be {2 B} but got %v`, rows[1])
+	}
+}
+
+func TestDistinctStatement(t *testing.T) {
+	query := DistinctQuery{
+		Table:         `TABLE`,
+		Column:        `OBJECT`,
+		Where:         []SqlSnippetGenerator{&EqualClause{Identifier: `KEY`, Value: 3}},
+		IncludeCounts: true,
+		OrderBy:       `count`,
+		Descending:    true,
+		Limit:         50,
+	}
+	stmnt, params, err := distinctStatement(query)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	expected := `SELECT "OBJECT",COUNT(*) AS "COUNT" FROM "TABLE" WHERE "KEY"=? GROUP BY "OBJECT" ORDER BY COUNT(*) DESC LIMIT 50`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 1 {
+		t.Fatalf(`expected 1 param but got %v`, len(params))
+	}
+}
+
+func TestDistinctStatementInvalidOrder(t *testing.T) {
+	_, _, err := distinctStatement(DistinctQuery{Table: `TABLE`, Column: `OBJECT`, OrderBy: `random`, Limit: 10})
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestReadStatementKeyset(t *testing.T) {
+	token, _ := EncodeCursor([]string{`KEY`}, []interface{}{3.0})
+	query := ReadQuery{
+		Table:     `TABLE`,
+		Fields:    []string{`KEY`, `NAME`},
+		Where:     []SqlSnippetGenerator{&EqualClause{Identifier: `OBJECT`, Value: `Task`}},
+		OrderBy:   []string{`KEY`},
+		PageSize:  10,
+		Keyset:    true,
+		PageToken: token,
+	}
+	stmnt, params, err := readStatement(query)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	expected := `SELECT "KEY","NAME" FROM "TABLE" WHERE "OBJECT"=? AND ((("KEY" > ? OR "KEY" IS NULL))) ORDER BY "KEY" LIMIT 11`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 2 {
+		t.Fatalf(`expected 2 params but got %v`, params)
+	}
+}
+
+func TestCountStatement(t *testing.T) {
+	query := ReadQuery{Table: `TABLE`, Where: []SqlSnippetGenerator{&EqualClause{Identifier: `OBJECT`, Value: `Task`}}}
+	stmnt, params := countStatement(query)
+	expected := `SELECT count(*) FROM "TABLE" WHERE "OBJECT"=?`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 1 {
+		t.Fatalf(`expected 1 param but got %v`, params)
+	}
+
+	query.ApproximateTotal = true
+	stmnt, _ = countStatement(query)
+	expected = `SELECT ROUND(count(*) * 100 / 10) FROM "TABLE" SAMPLE SYSTEM (10) WHERE "OBJECT"=?`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+}
+
+func TestReadStatementKeysetRequiresOrderByFields(t *testing.T) {
+	query := ReadQuery{Table: `TABLE`, Fields: []string{`NAME`}, OrderBy: []string{`KEY`}, PageSize: 10, Keyset: true}
+	_, _, err := readStatement(query)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestSetNextPageToken(t *testing.T) {
+	query := ReadQuery{OrderBy: []string{`KEY`}, PageSize: 2}
+	result := &QueryResult{
+		ColumnNames: []string{`KEY`, `NAME`},
+		RowCount:    3,
+		Data:        [][]interface{}{{1.0, 2.0, 3.0}, {`A`, `B`, `C`}},
+	}
+	err := setNextPageToken(query, result)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	if result.RowCount != 2 || len(result.Data[1]) != 2 {
+		t.Fatalf(`expected extra row to be trimmed but got %v`, result.Data)
+	}
+	values, err := DecodeCursor(result.NextPageToken, query.OrderBy)
+	if err != nil || values[0] != 2.0 {
+		t.Fatalf(`expected token after key 2 but got %v (%v)`, values, err)
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	query := ExportQuery{
+		Table:   `TABLE`,
+		Fields:  []string{`KEY`, `NAME`},
+		Where:   []SqlSnippetGenerator{&EqualClause{Identifier: `OBJECT`, Value: `Task`}},
+		OrderBy: []string{`KEY`},
+	}
+	stmnt, params, err := exportStatement(query)
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+	expected := `SELECT "KEY","NAME" FROM "TABLE" WHERE "OBJECT"=? ORDER BY "KEY"`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 1 {
+		t.Fatalf(`expected 1 param but got %v`, params)
+	}
+	stmnt, _, _ = selectStatement(SelectQuery{Table: `TEST`, Fields: []string{`CLOSED`}, Distinct: true})
+	expected = `SELECT DISTINCT "CLOSED" FROM "TEST"`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+}
+
+func TestNewPersistorPoolOptions(t *testing.T) {
+	persistor, err := NewPersistor(`user:password@account/db`, Options{MaxOpenConns: 3, Lazy: true})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	snowflake := persistor.(*SnowflakePersistor)
+	if snowflake.db != nil {
+		t.Fatalf(`expected lazy persistor not to open the pool`)
+	}
+	db, err := snowflake.database()
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if max := db.Stats().MaxOpenConnections; max != 3 {
+		t.Fatalf(`expected 3 max open connections but got %v`, max)
+	}
+	err = persistor.Close()
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+}
+
+func TestCloseUnopenedPersistor(t *testing.T) {
+	persistor, _ := NewPersistor(`user:password@account/db`, Options{Lazy: true})
+	err := persistor.Close()
+	if err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+}
+
+func TestReadStatementDistinct(t *testing.T) {
+	query := ReadQuery{Table: `TABLE`, Fields: []string{`CODE`, `LABEL`}, OrderBy: []string{`LABEL`, `CODE`}, PageSize: 10, Page: 2, Distinct: true}
+	stmnt, _, err := readStatement(query)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	expected := `SELECT DISTINCT "CODE","LABEL" FROM "TABLE" ORDER BY "LABEL","CODE" OFFSET 10 ROWS FETCH NEXT 10 ROWS ONLY`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	stmnt, _ = countStatement(query)
+	expected = `SELECT count(*) FROM (SELECT DISTINCT "CODE","LABEL" FROM "TABLE")`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+}
+
+func TestSelectStatement(t *testing.T) {
+	query := SelectQuery{Table: `HISTORY`, Fields: []string{`CHANGE_ID`, `ROW_KEY`}, Where: []SqlSnippetGenerator{&EqualClause{Identifier: `CHANGED_BY`, Value: `me`}}, OrderBy: []string{`CHANGED_AT`}, Descending: true, Limit: 5}
+	stmnt, params, err := selectStatement(query)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	expected := `SELECT "CHANGE_ID","ROW_KEY" FROM "HISTORY" WHERE "CHANGED_BY"=? ORDER BY "CHANGED_AT" DESC LIMIT 5`
+	if stmnt != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, stmnt)
+	}
+	if len(params) != 1 {
+		t.Fatalf(`expected 1 param but got %v`, params)
+	}
+}
@@ -51,6 +51,39 @@ func (clause *InClause) ParamsRequired() int {
 	return len(clause.Values)
 }
 
+// KeysClause matches rows whose key fields equal any of the given sets of
+// values, e.g. ("A","B") IN ((?,?),(?,?)).
+type KeysClause struct {
+	Identifiers []string
+	Values      [][]interface{}
+}
+
+func (clause *KeysClause) ToSqlSnippet() *SqlSnippet {
+	params := make([]interface{}, 0, len(clause.Identifiers)*len(clause.Values))
+	if len(clause.Identifiers) == 0 || len(clause.Values) == 0 {
+		return &SqlSnippet{Snippet: `1=2`, Params: params}
+	}
+	tuple := `?` + strings.Repeat(`,?`, len(clause.Identifiers)-1)
+	identifiers := QuoteIdentifiers(clause.Identifiers)
+	if len(clause.Identifiers) > 1 {
+		tuple = fmt.Sprintf(`(%v)`, tuple)
+		identifiers = fmt.Sprintf(`(%v)`, identifiers)
+	}
+	tuples := make([]string, len(clause.Values))
+	for index, values := range clause.Values {
+		tuples[index] = tuple
+		params = append(params, values...)
+	}
+	return &SqlSnippet{
+		Snippet: fmt.Sprintf(`%v IN (%v)`, identifiers, strings.Join(tuples, `,`)),
+		Params:  params,
+	}
+}
+
+func (clause *KeysClause) ParamsRequired() int {
+	return len(clause.Identifiers) * len(clause.Values)
+}
+
 type RangeClause struct {
 	Identifier   string
 	IncludeNulls bool
@@ -99,6 +132,62 @@ func (clause *RangeClause) generateParams() []interface{} {
 	return params
 }
 
+type NotDeletedClause struct {
+	Identifier string
+	IsFlag     bool
+	Exclude    bool
+}
+
+func (clause *NotDeletedClause) ToSqlSnippet() *SqlSnippet {
+	quoted := QuoteIdentifier(clause.Identifier)
+	whereClause := fmt.Sprintf(`%v IS NULL`, quoted)
+	if clause.IsFlag {
+		whereClause = fmt.Sprintf(`(%v OR %v=FALSE)`, whereClause, quoted)
+	}
+	if clause.Exclude {
+		whereClause = fmt.Sprintf(`NOT %v`, whereClause)
+		if !clause.IsFlag {
+			whereClause = fmt.Sprintf(`%v IS NOT NULL`, quoted)
+		}
+	}
+	return &SqlSnippet{
+		Snippet: whereClause,
+		Params:  make([]interface{}, 0),
+	}
+}
+
+func (clause *NotDeletedClause) ParamsRequired() int {
+	return 0
+}
+
+type SearchClause struct {
+	Identifiers []string
+	Text        string
+}
+
+func (clause *SearchClause) ToSqlSnippet() *SqlSnippet {
+	pattern := `%` + escapeLikePattern(clause.Text) + `%`
+	searches := make([]string, len(clause.Identifiers))
+	params := make([]interface{}, len(clause.Identifiers))
+	for index, identifier := range clause.Identifiers {
+		searches[index] = fmt.Sprintf(`TO_VARCHAR(%v) ILIKE ? ESCAPE '\\'`, QuoteIdentifier(identifier))
+		params[index] = pattern
+	}
+	return &SqlSnippet{
+		Snippet: fmt.Sprintf(`(%v)`, strings.Join(searches, ` OR `)),
+		Params:  params,
+	}
+}
+
+func (clause *SearchClause) ParamsRequired() int {
+	return len(clause.Identifiers)
+}
+
+func escapeLikePattern(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(text)
+}
+
 func GenerateCombinedWhereClause(clauses []SqlSnippetGenerator) *SqlPart {
 	wheres := make([]string, 0, len(clauses))
 	allParams := make([]interface{}, 0)
@@ -233,3 +233,65 @@ func TestWhereClauseNotInWithZeroItems(t *testing.T) {
 		t.Fatalf(`expected 0 params but got %v`, len(where.Params))
 	}
 }
+
+func TestWhereNotDeletedTimestamp(t *testing.T) {
+	clause := NotDeletedClause{Identifier: `DELETED_AT`}
+	where := clause.ToSqlSnippet()
+	expected := `"DELETED_AT" IS NULL`
+	if where.Snippet != expected {
+		t.Fatalf(`expected where clause of '%v' but got '%v'`, expected, where.Snippet)
+	}
+	if count := len(where.Params); count != 0 {
+		t.Fatalf(`expected 0 params but got %v`, count)
+	}
+	t.Log(where.Snippet)
+}
+
+func TestWhereNotDeletedFlag(t *testing.T) {
+	clause := NotDeletedClause{Identifier: `IS_DELETED`, IsFlag: true}
+	where := clause.ToSqlSnippet()
+	expected := `("IS_DELETED" IS NULL OR "IS_DELETED"=FALSE)`
+	if where.Snippet != expected {
+		t.Fatalf(`expected where clause of '%v' but got '%v'`, expected, where.Snippet)
+	}
+	t.Log(where.Snippet)
+}
+
+func TestWhereSearch(t *testing.T) {
+	clause := SearchClause{Identifiers: []string{`CODE`, `LABEL`}, Text: `50%_off`}
+	where := clause.ToSqlSnippet()
+	expected := `(TO_VARCHAR("CODE") ILIKE ? ESCAPE '\\' OR TO_VARCHAR("LABEL") ILIKE ? ESCAPE '\\')`
+	if where.Snippet != expected {
+		t.Fatalf(`expected where clause of '%v' but got '%v'`, expected, where.Snippet)
+	}
+	if count := len(where.Params); count != 2 {
+		t.Fatalf(`expected 2 params but got %v`, count)
+	}
+	if param := where.Params[0]; param != `%50\%\_off%` {
+		t.Fatalf(`expected escaped pattern but got '%v'`, param)
+	}
+	t.Log(where.Snippet)
+}
+
+func TestWhereDeletedFlag(t *testing.T) {
+	clause := NotDeletedClause{Identifier: `IS_DELETED`, IsFlag: true, Exclude: true}
+	where := clause.ToSqlSnippet()
+	expected := `NOT ("IS_DELETED" IS NULL OR "IS_DELETED"=FALSE)`
+	if where.Snippet != expected {
+		t.Fatalf(`expected where clause of '%v' but got '%v'`, expected, where.Snippet)
+	}
+	t.Log(where.Snippet)
+}
+
+func TestWhereKeys(t *testing.T) {
+	clause := KeysClause{Identifiers: []string{`A`, `B`}, Values: [][]interface{}{{1, `x`}, {2, `y`}}}
+	where := clause.ToSqlSnippet()
+	expected := `("A","B") IN ((?,?),(?,?))`
+	if where.Snippet != expected {
+		t.Fatalf(`expected where clause of '%v' but got '%v'`, expected, where.Snippet)
+	}
+	if len(where.Params) != 4 || where.Params[2] != 2 {
+		t.Fatalf(`expected 4 params in tuple order but got %v`, where.Params)
+	}
+	t.Log(where.Snippet)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const hashedApiKeyPrefix = `sha256:`
+
+// sharedApiKeyUser is the identity recorded for callers that authenticate
+// with the shared Settings.ApiKey instead of a key from Settings.Users.
+const sharedApiKeyUser = `api`
+
+// UserKey gives a caller its own API key so that the server knows who made a
+// change. ApiKey may be hashed like Settings.ApiKey.
+type UserKey struct {
+	Name   string
+	ApiKey string
+}
+
+// HashApiKey returns the value to store in ApiKey so that server.json does
+// not contain the key itself.
+func HashApiKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hashedApiKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+func GenerateApiKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return ``, err
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+func matchesApiKey(configured string, provided string) bool {
+	if strings.HasPrefix(configured, hashedApiKeyPrefix) {
+		provided = HashApiKey(provided)
+	}
+	return subtle.ConstantTimeCompare([]byte(configured), []byte(provided)) == 1
+}
+
+// authenticate returns the identity of the caller holding apiKey. The
+// identity comes from the settings and never from the request body.
+func (s Settings) authenticate(apiKey string) (string, bool) {
+	for _, user := range s.Users {
+		if apiKey != `` && matchesApiKey(user.ApiKey, apiKey) {
+			return user.Name, true
+		}
+	}
+	if s.ApiKey == `` && len(s.Users) > 0 {
+		return ``, false
+	}
+	if matchesApiKey(s.ApiKey, apiKey) {
+		return sharedApiKeyUser, true
+	}
+	return ``, false
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"tableau_crud/audit"
+	"testing"
+)
+
+func TestMatchesApiKey(t *testing.T) {
+	if !matchesApiKey(`12345`, `12345`) || matchesApiKey(`12345`, `67890`) {
+		t.Fatalf(`expected plain keys to be compared directly`)
+	}
+	hashed := HashApiKey(`12345`)
+	if !matchesApiKey(hashed, `12345`) {
+		t.Fatalf(`expected hashed key to match`)
+	}
+	if matchesApiKey(hashed, hashed) || matchesApiKey(hashed, `67890`) {
+		t.Fatalf(`expected hashed key to only match the original key`)
+	}
+}
+
+func TestGenerateApiKey(t *testing.T) {
+	first, err := GenerateApiKey()
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	second, _ := GenerateApiKey()
+	if len(first) < 40 || first == second {
+		t.Fatalf(`expected long unique keys but got %v and %v`, first, second)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	settings := Settings{ApiKey: `shared`, Users: []UserKey{{Name: `alice`, ApiKey: HashApiKey(`alice-key`)}, {Name: `bob`, ApiKey: `bob-key`}}}
+	for key, expected := range map[string]string{`alice-key`: `alice`, `bob-key`: `bob`, `shared`: sharedApiKeyUser} {
+		user, ok := settings.authenticate(key)
+		if !ok || user != expected {
+			t.Fatalf(`expected %v for %v but got %v`, expected, key, user)
+		}
+	}
+	if _, ok := settings.authenticate(`other`); ok {
+		t.Fatalf(`expected unknown key to be rejected`)
+	}
+	settings.ApiKey = ``
+	if _, ok := settings.authenticate(``); ok {
+		t.Fatalf(`expected empty key to be rejected when only user keys are configured`)
+	}
+}
+
+func TestValidatePayloadIgnoresClientUser(t *testing.T) {
+	s := &Server{Settings: Settings{Users: []UserKey{{Name: `alice`, ApiKey: `alice-key`}}}}
+	r := httptest.NewRequest(`POST`, `/api/insert`, strings.NewReader(`{"ApiKey":"alice-key","User":"mallory","Connection":"test"}`))
+	params, err := validatePayload[InsertParams](s, r)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if params.User != `alice` {
+		t.Fatalf(`expected user derived from the api key but got %v`, params.User)
+	}
+}
+
+type memorySink struct {
+	entries []audit.Entry
+}
+
+func (m *memorySink) Write(entry audit.Entry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *memorySink) Close() error {
+	return nil
+}
+
+func TestAuditRecordsAuthenticatedUser(t *testing.T) {
+	sink := &memorySink{}
+	s := &Server{Settings: Settings{Users: []UserKey{{Name: `alice`, ApiKey: `alice-key`}}}, Audit: sink}
+	r := httptest.NewRequest(`POST`, `/api/delete`, strings.NewReader(`{"ApiKey":"alice-key","User":"mallory"}`))
+	params, err := validatePayload[DeleteParams](s, r)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	s.recordAudit(r, params.User, audit.Entry{Operation: `delete`})
+	if len(sink.entries) != 1 || sink.entries[0].User != `alice` {
+		t.Fatalf(`expected audit entry for alice but got %+v`, sink.entries)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// operations are the names accepted in Connection.OperationTimeouts.
+var operations = map[string]bool{
+	`select`: true, `insert`: true, `update`: true, `delete`: true, `test`: true, `history`: true,
+	`undo`: true, `lookup`: true, `distinct`: true, `aggregate`: true, `export`: true, `import`: true,
+}
+
+// CheckSettings loads the settings file and reports every problem found
+// without opening any connections.
+func CheckSettings(settingsPath string) []error {
+	settings, problems, err := readSettings(settingsPath)
+	if err != nil {
+		return []error{err}
+	}
+	return append(problems, settings.problems()...)
+}
+
+func (s Settings) problems() []error {
+	problems := make([]error, 0)
+	if s.Address == `` {
+		problems = append(problems, errors.New(`Address must be provided`))
+	} else if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		problems = append(problems, fmt.Errorf(`Address %q must be host:port`, s.Address))
+	}
+	if s.ApiKey == `` && len(s.Users) == 0 {
+		problems = append(problems, errors.New(`ApiKey or Users must be provided`))
+	}
+	users := make(map[string]bool, len(s.Users))
+	for index, user := range s.Users {
+		if user.Name == `` {
+			problems = append(problems, fmt.Errorf(`user %v must have a Name`, index+1))
+		} else if users[user.Name] || user.Name == sharedApiKeyUser {
+			problems = append(problems, fmt.Errorf(`user %q is defined more than once or reserved`, user.Name))
+		}
+		users[user.Name] = true
+		if user.ApiKey == `` {
+			problems = append(problems, fmt.Errorf(`user %q must have an ApiKey`, user.Name))
+		}
+	}
+	names := make(map[string]bool, len(s.Connections))
+	for index, conn := range s.Connections {
+		name := strings.ToLower(conn.Name)
+		if name == `` {
+			problems = append(problems, fmt.Errorf(`connection %v must have a Name`, index+1))
+		} else if names[name] {
+			problems = append(problems, fmt.Errorf(`connection %q is defined more than once`, conn.Name))
+		}
+		names[name] = true
+		if conn.Driver != `snowflake` {
+			problems = append(problems, fmt.Errorf(`connection %q has invalid driver %q, expected 'snowflake'`, conn.Name, conn.Driver))
+		}
+		if conn.ConnStr == `` {
+			problems = append(problems, fmt.Errorf(`connection %q must have a ConnStr`, conn.Name))
+		}
+		if conn.CountCacheSeconds < 0 {
+			problems = append(problems, fmt.Errorf(`connection %q CountCacheSeconds must not be negative`, conn.Name))
+		}
+		if conn.StatementTimeoutSeconds < 0 {
+			problems = append(problems, fmt.Errorf(`connection %q StatementTimeoutSeconds must not be negative`, conn.Name))
+		}
+		problems = append(problems, conn.Pool.problems(conn.Name)...)
+		for _, operation := range sortedOperations(conn.OperationTimeouts) {
+			if !operations[operation] {
+				problems = append(problems, fmt.Errorf(`connection %q has a timeout for unknown operation %q`, conn.Name, operation))
+			} else if conn.OperationTimeouts[operation] < 0 {
+				problems = append(problems, fmt.Errorf(`connection %q timeout for %q must not be negative`, conn.Name, operation))
+			}
+		}
+		for tableIndex, table := range conn.Tables {
+			if table.Name == `` {
+				problems = append(problems, fmt.Errorf(`connection %q table %v must have a Name`, conn.Name, tableIndex+1))
+			}
+		}
+		if err := validateTables(conn); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	switch s.Audit.Sink {
+	case ``:
+	case `file`:
+		if s.Audit.Path == `` {
+			problems = append(problems, errors.New(`audit path must be provided`))
+		}
+	case `table`:
+		if !names[strings.ToLower(s.Audit.Connection)] {
+			problems = append(problems, fmt.Errorf(`audit connection %q is not valid`, s.Audit.Connection))
+		}
+		if s.Audit.Table == `` {
+			problems = append(problems, errors.New(`audit table must be provided`))
+		}
+	default:
+		problems = append(problems, fmt.Errorf(`invalid audit sink %q, expected 'file' or 'table'`, s.Audit.Sink))
+	}
+	return problems
+}
+
+func sortedOperations(timeouts map[string]int) []string {
+	names := make([]string, 0, len(timeouts))
+	for name := range timeouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p Pool) problems(connection string) []error {
+	problems := make([]error, 0)
+	if p.MaxOpenConns < 0 {
+		problems = append(problems, fmt.Errorf(`connection %q Pool.MaxOpenConns must not be negative`, connection))
+	}
+	if p.ConnMaxLifetimeSeconds < 0 {
+		problems = append(problems, fmt.Errorf(`connection %q Pool.ConnMaxLifetimeSeconds must not be negative`, connection))
+	}
+	if p.ConnMaxIdleTimeSeconds < 0 {
+		problems = append(problems, fmt.Errorf(`connection %q Pool.ConnMaxIdleTimeSeconds must not be negative`, connection))
+	}
+	if p.Lazy && p.WarmUp {
+		problems = append(problems, fmt.Errorf(`connection %q Pool cannot be both Lazy and WarmUp`, connection))
+	}
+	return problems
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"tableau_crud/audit"
+	"testing"
+)
+
+func TestCheckSettingsValid(t *testing.T) {
+	problems := CheckSettings(`validSettings.json`)
+	if len(problems) != 0 {
+		t.Fatalf(`expected no problems but got %v`, problems)
+	}
+}
+
+func TestSettingsProblems(t *testing.T) {
+	settings := Settings{
+		Connections: []Connection{
+			{Name: `test`, Driver: `snowflake`, ConnStr: `x`},
+			{Name: `Test`, Driver: `postgres`},
+		},
+		Audit: audit.Settings{Sink: `table`, Connection: `missing`},
+	}
+	problems := settings.problems()
+	if len(problems) != 7 {
+		t.Fatalf(`expected 7 problems but got %v`, problems)
+	}
+	for _, problem := range problems {
+		t.Log(problem.Error())
+	}
+}
+
+func TestPoolProblems(t *testing.T) {
+	pool := Pool{MaxOpenConns: -1, ConnMaxIdleTimeSeconds: -5, Lazy: true, WarmUp: true}
+	problems := pool.problems(`test`)
+	if len(problems) != 3 {
+		t.Fatalf(`expected 3 problems but got %v`, problems)
+	}
+	if problems := (Pool{MaxOpenConns: 4, MaxIdleConns: -1, Lazy: true}).problems(`test`); len(problems) != 0 {
+		t.Fatalf(`expected no problems but got %v`, problems)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const encryptedSecretPrefix = `enc:`
+
+const masterKeyFileName = `master.key`
+
+// MasterKeyPath returns the default location of the master key, next to the
+// settings file.
+func MasterKeyPath(settingsPath string) string {
+	return filepath.Join(filepath.Dir(settingsPath), masterKeyFileName)
+}
+
+func (s Settings) masterKeyPath(settingsPath string) string {
+	if s.MasterKey != `` {
+		return s.MasterKey
+	}
+	return MasterKeyPath(settingsPath)
+}
+
+// SettingsMasterKeyPath returns the master key used by the settings file at
+// settingsPath and whether the file sets it with MasterKey. A settings file
+// that does not exist yet uses the default location.
+func SettingsMasterKeyPath(settingsPath string) (string, bool, error) {
+	content, err := os.ReadFile(settingsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return MasterKeyPath(settingsPath), false, nil
+	}
+	if err != nil {
+		return ``, false, err
+	}
+	settings, _, err := decodeSettings(settingsPath, content)
+	if err != nil {
+		return ``, false, err
+	}
+	return settings.masterKeyPath(settingsPath), settings.MasterKey != ``, nil
+}
+
+// GenerateMasterKey writes a new random AES-256 key to path. An existing key
+// is never overwritten because every value encrypted with it would be lost.
+func GenerateMasterKey(path string) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	return key, errors.Join(err, file.Close())
+}
+
+func LoadMasterKey(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(`error reading master key: %w`, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf(`master key %v is not a base64 encoded 32 byte key`, path)
+	}
+	return key, nil
+}
+
+// EncryptSecret returns an enc: value that loadSettings decrypts with the
+// same master key.
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return ``, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return ``, err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(key []byte, value string) (string, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return ``, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return ``, errors.New(`encrypted value is malformed`)
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return ``, errors.New(`encrypted value could not be decrypted with the master key`)
+	}
+	return string(plaintext), nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
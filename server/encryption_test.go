@@ -0,0 +1,74 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecryptSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), masterKeyFileName)
+	key, err := GenerateMasterKey(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	loaded, err := LoadMasterKey(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	encrypted, err := EncryptSecret(key, `12345`)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	decrypted, err := decryptSecret(loaded, encrypted)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if decrypted != `12345` {
+		t.Fatalf(`expected 12345 but got %v`, decrypted)
+	}
+}
+
+func TestGenerateMasterKeyDoesNotOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), masterKeyFileName)
+	_, err := GenerateMasterKey(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	_, err = GenerateMasterKey(path)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+}
+
+func TestDecryptSecretWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := GenerateMasterKey(filepath.Join(dir, `a.key`))
+	other, _ := GenerateMasterKey(filepath.Join(dir, `b.key`))
+	encrypted, _ := EncryptSecret(key, `12345`)
+	_, err := decryptSecret(other, encrypted)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	_, err = decryptSecret(key, `enc:not base64!`)
+	if err == nil {
+		t.Fatalf(`expected error for malformed value but got none`)
+	}
+}
+
+func TestSettingsMasterKeyPath(t *testing.T) {
+	dir := t.TempDir()
+	settingsPath := filepath.Join(dir, `server.yaml`)
+	path, configured, err := SettingsMasterKeyPath(settingsPath)
+	if err != nil || configured || path != filepath.Join(dir, masterKeyFileName) {
+		t.Fatalf(`expected the default key for a missing settings file but got %v, %v, %v`, path, configured, err)
+	}
+	err = os.WriteFile(settingsPath, []byte("MasterKey: /secrets/crud.key\n"), 0600)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	path, configured, err = SettingsMasterKeyPath(settingsPath)
+	if err != nil || !configured || path != `/secrets/crud.key` {
+		t.Fatalf(`expected the configured key but got %v, %v, %v`, path, configured, err)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	errorMessaging "tableau_crud/error_messaging"
+	"tableau_crud/history"
+	v "tableau_crud/params_validators"
+)
+
+const requestIdHeader = `X-Request-Id`
+
+// statusClientClosedRequest is the non-standard status used by proxies such as
+// nginx when the client disconnects before the response is sent.
+const statusClientClosedRequest = 499
+
+type ApiError struct {
+	Status    int `json:"-"`
+	Code      string
+	Message   string
+	Field     string      `json:",omitempty"`
+	Details   interface{} `json:",omitempty"`
+	RequestId string
+	cause     error
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+type errorEnvelope struct {
+	Error *ApiError
+}
+
+func newApiError(status int, code string, message string) *ApiError {
+	return &ApiError{Status: status, Code: code, Message: message}
+}
+
+func badRequest(code string, err error) *ApiError {
+	return newApiError(http.StatusBadRequest, code, err.Error())
+}
+
+func invalidField(field string, message string, err error) *ApiError {
+	apiErr := newApiError(http.StatusBadRequest, `invalid_field`, fmt.Sprintf(`%v: %v`, message, err.Error()))
+	apiErr.Field = field
+	return apiErr
+}
+
+func notFound(code string, format string, args ...interface{}) *ApiError {
+	return newApiError(http.StatusNotFound, code, fmt.Sprintf(format, args...))
+}
+
+var databaseStatuses = map[errorMessaging.Kind]int{
+	errorMessaging.Unknown:             http.StatusInternalServerError,
+	errorMessaging.InvalidRequest:      http.StatusBadRequest,
+	errorMessaging.DatabaseError:       http.StatusBadGateway,
+	errorMessaging.ConstraintViolation: http.StatusConflict,
+	errorMessaging.MissingObject:       http.StatusNotFound,
+	errorMessaging.PermissionDenied:    http.StatusForbidden,
+	errorMessaging.Timeout:             http.StatusGatewayTimeout,
+	errorMessaging.TypeMismatch:        http.StatusBadRequest,
+	errorMessaging.InvalidQuery:        http.StatusBadRequest,
+	errorMessaging.Unavailable:         http.StatusBadGateway,
+	errorMessaging.Canceled:            statusClientClosedRequest,
+}
+
+// databaseError replaces driver errors with a stable code and a message that
+// is safe to show. The raw error is logged when the response is sent.
+func databaseError(message string, err error) *ApiError {
+	if errors.Is(err, history.ErrConflict) || errors.Is(err, history.ErrAlreadyUndone) {
+		return newApiError(http.StatusConflict, `conflict`, err.Error())
+	}
+	classification := errorMessaging.Classify(err)
+	apiErr := newApiError(databaseStatuses[classification.Kind], classification.Code, fmt.Sprintf(`%v: %v`, message, classification.Message))
+	apiErr.cause = err
+	return apiErr
+}
+
+func toApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var validationErr *v.ValidationError
+	if errors.As(err, &validationErr) {
+		apiErr = newApiError(http.StatusBadRequest, `validation_failed`, validationErr.Error())
+		apiErr.Details = validationErr.Errors
+		if len(validationErr.Errors) == 1 {
+			apiErr.Field = validationErr.Errors[0].Field
+		}
+		return apiErr
+	}
+	if errors.Is(err, history.ErrConflict) || errors.Is(err, history.ErrAlreadyUndone) {
+		return newApiError(http.StatusConflict, `conflict`, err.Error())
+	}
+	return databaseError(`error processing request`, err)
+}
+
+func withRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(requestIdHeader)
+		if requestId == `` || len(requestId) > 128 {
+			requestId = uuid.NewString()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sendErrorResponse(w http.ResponseWriter, err error) {
+	apiErr := *toApiError(err)
+	apiErr.RequestId = w.Header().Get(requestIdHeader)
+	if apiErr.Status == statusClientClosedRequest {
+		log.Printf(`request %v was canceled by the client`, apiErr.RequestId)
+	} else if apiErr.cause != nil {
+		log.Printf(`request %v failed with %v: %v`, apiErr.RequestId, apiErr.Code, apiErr.cause.Error())
+	}
+	setHeaders(w, "application/json")
+	w.WriteHeader(apiErr.Status)
+	responseBytes, _ := json.Marshal(errorEnvelope{Error: &apiErr})
+	_, _ = w.Write(responseBytes)
+}
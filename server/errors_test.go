@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/snowflakedb/gosnowflake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	errorMessaging "tableau_crud/error_messaging"
+	"tableau_crud/history"
+	v "tableau_crud/params_validators"
+	"tableau_crud/persistance"
+	"testing"
+)
+
+func sendTestRequest(s *Server, handler http.HandlerFunc, body string) (*httptest.ResponseRecorder, *ApiError) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(`POST`, `https://test.com/api/test`, strings.NewReader(body))
+	withRequestId(handler).ServeHTTP(w, r)
+	envelope := errorEnvelope{}
+	_ = json.Unmarshal(w.Body.Bytes(), &envelope)
+	return w, envelope.Error
+}
+
+func TestErrorResponseStatuses(t *testing.T) {
+	s := &Server{Settings: Settings{ApiKey: `12345`}, Persistors: map[string]persistance.Persistor{}}
+	cases := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"ApiKey":"12345"`, 400, `invalid_payload`},
+		{`{"Connection":"test"}`, 401, `missing_api_key`},
+		{`{"ApiKey":"67890","Connection":"test"}`, 403, `invalid_api_key`},
+		{`{"ApiKey":"12345","Connection":"test"}`, 404, `connection_not_found`},
+	}
+	for _, c := range cases {
+		w, apiErr := sendTestRequest(s, s.handleTestConnection, c.body)
+		if w.Code != c.status || apiErr == nil || apiErr.Code != c.code {
+			t.Fatalf(`expected %v %v for %v but got %v %v`, c.status, c.code, c.body, w.Code, w.Body.String())
+		}
+		if apiErr.RequestId == `` || apiErr.RequestId != w.Header().Get(requestIdHeader) {
+			t.Fatalf(`expected request id in body and header but got '%v' and '%v'`, apiErr.RequestId, w.Header().Get(requestIdHeader))
+		}
+		if w.Header().Get(`Access-Control-Allow-Origin`) != `*` {
+			t.Fatalf(`expected CORS headers on error response`)
+		}
+	}
+}
+
+func TestToApiError(t *testing.T) {
+	validationErr := &v.ValidationError{Errors: []v.FieldError{{Field: `NAME`, Rule: `required`, Message: `a value is required`}}}
+	apiErr := toApiError(validationErr)
+	if apiErr.Status != 400 || apiErr.Field != `NAME` || apiErr.Details == nil {
+		t.Fatalf(`expected 400 on NAME with details but got %+v`, apiErr)
+	}
+	apiErr = toApiError(fmt.Errorf(`change 1: %w`, history.ErrConflict))
+	if apiErr.Status != 409 {
+		t.Fatalf(`expected 409 but got %v`, apiErr.Status)
+	}
+	apiErr = databaseError(`error reading records`, &gosnowflake.SnowflakeError{Number: 2003, SQLState: `42S02`, Message: `Object 'SECRET_TABLE' does not exist`})
+	if apiErr.Status != 404 || apiErr.Code != `object_not_found` || strings.Contains(apiErr.Message, `SECRET_TABLE`) {
+		t.Fatalf(`expected safe 404 object_not_found but got %+v`, apiErr)
+	}
+	apiErr = databaseError(`error reading records`, errorMessaging.NewUserError(`at least 1 field must be provided`))
+	if apiErr.Status != 400 || !strings.Contains(apiErr.Message, `at least 1 field`) {
+		t.Fatalf(`expected 400 keeping the server message but got %+v`, apiErr)
+	}
+	apiErr = databaseError(`error reading records`, fmt.Errorf(`query: %w`, context.Canceled))
+	if apiErr.Status != 499 || apiErr.Code != `request_canceled` {
+		t.Fatalf(`expected 499 request_canceled but got %+v`, apiErr)
+	}
+	apiErr = toApiError(errors.New(`sql: transaction has already been committed or rolled back`))
+	if apiErr.Status != 500 || strings.Contains(apiErr.Message, `sql:`) {
+		t.Fatalf(`expected generic 500 but got %+v`, apiErr)
+	}
+}
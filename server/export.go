@@ -0,0 +1,303 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	v "tableau_crud/params_validators"
+	p "tableau_crud/persistance"
+	"time"
+)
+
+const exportSheetName = `Sheet1`
+
+type ExportParams struct {
+	ApiKey
+	Connection     string
+	Table          string
+	Fields         []string
+	Where          []interface{}
+	OrderBy        []string
+	Format         string
+	FileName       string
+	IncludeDeleted bool
+}
+
+// exportFormat describes a file format. Buffered formats cannot be streamed,
+// so the whole file is built in a temporary file before any of the response
+// is sent.
+type exportFormat struct {
+	extension   string
+	contentType string
+	buffered    bool
+	newWriter   func(w io.Writer) exportRowWriter
+}
+
+type exportRowWriter interface {
+	p.RowWriter
+	Close() error
+}
+
+var exportFormats = map[string]exportFormat{
+	`csv`:    {extension: `csv`, contentType: `text/csv`, newWriter: newCsvExportWriter},
+	`ndjson`: {extension: `ndjson`, contentType: `application/x-ndjson`, newWriter: newNdjsonExportWriter},
+	`xlsx`:   {extension: `xlsx`, contentType: `application/vnd.openxmlformats-officedocument.spreadsheetml.sheet`, buffered: true, newWriter: newXlsxExportWriter},
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	params, err := validatePayload[ExportParams](s, r)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	persistor, err := s.getPersistor(params.Connection)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `export`)
+	defer cancel()
+	if params.Format == `` {
+		params.Format = `csv`
+	}
+	format, ok := exportFormats[params.Format]
+	if !ok {
+		sendErrorResponse(w, invalidField(`Format`, `invalid export format`, fmt.Errorf(`%q, expected 'csv', 'ndjson' or 'xlsx'`, params.Format)))
+		return
+	}
+	whereClauses, err := v.ValidateWhereClauses(params.Where)
+	if err != nil {
+		sendErrorResponse(w, invalidField(`Where`, `error decoding where clauses`, err))
+		return
+	}
+	if table := s.getTable(params.Connection, params.Table); table.IsSoftDelete() && !params.IncludeDeleted {
+		whereClauses = append(whereClauses, table.notDeletedClause())
+	}
+	fileName := params.FileName
+	if fileName == `` {
+		fileName = fmt.Sprintf(`%v.%v`, params.Table, format.extension)
+	}
+
+	clearWriteDeadline(w)
+	writer := &responseExportWriter{w: w, format: format, fileName: fileName}
+	defer writer.remove()
+	err = persistor.Export(ctx, p.ExportQuery{
+		Table:   params.Table,
+		Fields:  params.Fields,
+		Where:   whereClauses,
+		OrderBy: params.OrderBy,
+	}, writer)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		if !writer.started {
+			sendErrorResponse(w, databaseError(`error exporting records`, err))
+			return
+		}
+		// Part of the file has already been sent with a 200, so abort the
+		// connection rather than let the client keep a truncated file.
+		log.Printf(`error exporting %v from connection %v: %v`, params.Table, params.Connection, err.Error())
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// responseExportWriter delays committing the response headers until the
+// query has returned its columns so that query errors can still be reported.
+// Buffered formats delay them until the whole file has been built in a
+// temporary file, which is then copied to the response.
+type responseExportWriter struct {
+	w        http.ResponseWriter
+	format   exportFormat
+	fileName string
+	started  bool
+	file     *os.File
+	writer   exportRowWriter
+}
+
+func (e *responseExportWriter) WriteHeader(columns []string) error {
+	if e.format.buffered {
+		file, err := os.CreateTemp(``, `tableau_crud_export_*.`+e.format.extension)
+		if err != nil {
+			return err
+		}
+		e.file = file
+		e.writer = e.format.newWriter(e.file)
+		return e.writer.WriteHeader(columns)
+	}
+	e.start()
+	e.writer = e.format.newWriter(e.w)
+	return e.writer.WriteHeader(columns)
+}
+
+func (e *responseExportWriter) start() {
+	setHeaders(e.w, e.format.contentType)
+	e.w.Header().Set(`Content-Disposition`, mime.FormatMediaType(`attachment`, map[string]string{`filename`: e.fileName}))
+	e.started = true
+}
+
+func (e *responseExportWriter) WriteRow(values []interface{}) error {
+	return e.writer.WriteRow(values)
+}
+
+func (e *responseExportWriter) Close() error {
+	if e.writer == nil {
+		return nil
+	}
+	err := e.writer.Close()
+	if err != nil || e.file == nil {
+		return err
+	}
+	size, err := e.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = e.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	e.w.Header().Set(`Content-Length`, strconv.FormatInt(size, 10))
+	e.start()
+	_, err = io.Copy(e.w, e.file)
+	return err
+}
+
+func (e *responseExportWriter) remove() {
+	if e.file == nil {
+		return
+	}
+	_ = e.file.Close()
+	err := os.Remove(e.file.Name())
+	if err != nil {
+		log.Printf(`error removing export file %v: %v`, e.file.Name(), err.Error())
+	}
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCsvExportWriter(w io.Writer) exportRowWriter {
+	return &csvExportWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvExportWriter) WriteHeader(columns []string) error {
+	c.record = make([]string, len(columns))
+	return c.writer.Write(columns)
+}
+
+func (c *csvExportWriter) WriteRow(values []interface{}) error {
+	for index, value := range values {
+		c.record[index] = exportString(value)
+	}
+	return c.writer.Write(c.record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func exportString(value interface{}) string {
+	switch t := value.(type) {
+	case nil:
+		return ``
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case []byte:
+		return string(t)
+	default:
+		return fmt.Sprintf(`%v`, t)
+	}
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+	columns []string
+}
+
+func newNdjsonExportWriter(w io.Writer) exportRowWriter {
+	return &ndjsonExportWriter{encoder: json.NewEncoder(w)}
+}
+
+func (n *ndjsonExportWriter) WriteHeader(columns []string) error {
+	n.columns = columns
+	return nil
+}
+
+func (n *ndjsonExportWriter) WriteRow(values []interface{}) error {
+	row := make(map[string]interface{}, len(n.columns))
+	for index, column := range n.columns {
+		row[column] = values[index]
+	}
+	return n.encoder.Encode(row)
+}
+
+func (n *ndjsonExportWriter) Close() error {
+	return nil
+}
+
+// xlsxExportWriter uses the excelize stream writer, which spills rows to a
+// temporary file rather than keeping the whole sheet in memory. The finished
+// workbook is written to the export's own temporary file.
+type xlsxExportWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+	err    error
+}
+
+func newXlsxExportWriter(w io.Writer) exportRowWriter {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter(exportSheetName)
+	return &xlsxExportWriter{w: w, file: file, stream: stream, err: err}
+}
+
+func (x *xlsxExportWriter) WriteHeader(columns []string) error {
+	header := make([]interface{}, len(columns))
+	for index, column := range columns {
+		header[index] = column
+	}
+	return x.WriteRow(header)
+}
+
+func (x *xlsxExportWriter) WriteRow(values []interface{}) error {
+	if x.err != nil {
+		return x.err
+	}
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	for index, value := range values {
+		if bytes, ok := value.([]byte); ok {
+			values[index] = string(bytes)
+		}
+	}
+	return x.stream.SetRow(cell, values)
+}
+
+func (x *xlsxExportWriter) Close() error {
+	defer func() {
+		_ = x.file.Close()
+	}()
+	if x.err != nil {
+		return x.err
+	}
+	err := x.stream.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = x.file.WriteTo(x.w)
+	return err
+}
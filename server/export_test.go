@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/xuri/excelize/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	p "tableau_crud/persistance"
+	"testing"
+	"time"
+)
+
+func writeExport(t *testing.T, format string, columns []string, rows ...[]interface{}) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	writer := &responseExportWriter{w: w, format: exportFormats[format], fileName: `export.` + format}
+	defer writer.remove()
+	if err := writer.WriteHeader(columns); err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatalf(`got error %v`, err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	return w
+}
+
+func TestExportCsv(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	w := writeExport(t, `csv`, []string{`KEY`, `NAME`, `AT`}, []interface{}{1.0, `A, B`, at}, []interface{}{2.0, nil, nil})
+	expected := "KEY,NAME,AT\n1,\"A, B\",2020-01-02T03:04:05Z\n2,,\n"
+	if body := w.Body.String(); body != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, body)
+	}
+	if disposition := w.Header().Get(`Content-Disposition`); disposition != `attachment; filename=export.csv` {
+		t.Fatalf(`expected attachment disposition but got '%v'`, disposition)
+	}
+}
+
+func TestExportNdjson(t *testing.T) {
+	w := writeExport(t, `ndjson`, []string{`KEY`, `NAME`}, []interface{}{1.0, `A`}, []interface{}{2.0, nil})
+	expected := "{\"KEY\":1,\"NAME\":\"A\"}\n{\"KEY\":2,\"NAME\":null}\n"
+	if body := w.Body.String(); body != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, body)
+	}
+}
+
+func TestExportXlsx(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(`TMPDIR`, dir)
+	w := writeExport(t, `xlsx`, []string{`KEY`, `NAME`}, []interface{}{1.0, `A`}, []interface{}{2.0, nil})
+	if length := w.Header().Get(`Content-Length`); length != strconv.Itoa(w.Body.Len()) {
+		t.Fatalf(`expected Content-Length %v but got '%v'`, w.Body.Len(), length)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf(`expected the temporary file to be removed but found %v`, entries)
+	}
+	file, err := excelize.OpenReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	rows, err := file.GetRows(exportSheetName)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(rows) != 3 || strings.Join(rows[1], `,`) != `1,A` {
+		t.Fatalf(`expected 3 rows with [1 A] second but got %v`, rows)
+	}
+}
+
+type failingExportPersistor struct {
+	p.Persistor
+}
+
+func (f *failingExportPersistor) Export(_ context.Context, _ p.ExportQuery, writer p.RowWriter) error {
+	if err := writer.WriteHeader([]string{`KEY`}); err != nil {
+		return err
+	}
+	if err := writer.WriteRow([]interface{}{1.0}); err != nil {
+		return err
+	}
+	return errors.New(`connection lost`)
+}
+
+func exportFailure(format string) (w *httptest.ResponseRecorder, aborted interface{}) {
+	s := &Server{Settings: Settings{ApiKey: `12345`}, Persistors: map[string]p.Persistor{`test`: &failingExportPersistor{}}}
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(`POST`, `/api/export`, strings.NewReader(`{"ApiKey":"12345","Connection":"test","Table":"T","Format":"`+format+`"}`))
+	defer func() {
+		aborted = recover()
+	}()
+	s.handleExport(w, r)
+	return w, nil
+}
+
+func TestExportAbortsStreamAfterFailure(t *testing.T) {
+	_, aborted := exportFailure(`csv`)
+	if aborted != http.ErrAbortHandler {
+		t.Fatalf(`expected the handler to abort but got %v`, aborted)
+	}
+}
+
+func TestExportXlsxReportsFailure(t *testing.T) {
+	w, aborted := exportFailure(`xlsx`)
+	if aborted != nil {
+		t.Fatalf(`expected an error response but the handler aborted with %v`, aborted)
+	}
+	if w.Code == http.StatusOK || w.Header().Get(`Content-Disposition`) != `` {
+		t.Fatalf(`expected an error without a file but got %v %v`, w.Code, w.Header())
+	}
+}
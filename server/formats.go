@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"tableau_crud/persistance"
+	"time"
+)
+
+const arrowStreamContentType = `application/vnd.apache.arrow.stream`
+
+var responseFormats = []string{`columns`, `rows`, `objects`, `arrow`}
+
+type formattedResult struct {
+	Result *persistance.QueryResult
+	Format string
+}
+
+type rowsResult struct {
+	ColumnNames        []string
+	RowCount           int
+	Rows               interface{}
+	TotalRowCount      int
+	NextPageToken      string `json:",omitempty"`
+	TotalIsApproximate bool   `json:",omitempty"`
+}
+
+// responseFormat prefers the format requested in the payload and falls back
+// to the Accept header so that generic clients can ask for Arrow.
+func responseFormat(r *http.Request, requested string) (string, error) {
+	if requested != `` {
+		for _, format := range responseFormats {
+			if requested == format {
+				return requested, nil
+			}
+		}
+		return ``, invalidField(`Format`, `invalid format`, fmt.Errorf(`%q, expected one of %v`, requested, strings.Join(responseFormats, `, `)))
+	}
+	for _, accepted := range strings.Split(r.Header.Get(`Accept`), `,`) {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == arrowStreamContentType {
+			return `arrow`, nil
+		}
+	}
+	return `columns`, nil
+}
+
+func (f *formattedResult) marshal() ([]byte, error) {
+	switch f.Format {
+	case `rows`:
+		return json.Marshal(f.shape(f.Result.RowValues()))
+	case `objects`:
+		return json.Marshal(f.shape(f.Result.Rows()))
+	default:
+		return json.Marshal(f.Result)
+	}
+}
+
+func (f *formattedResult) shape(rows interface{}) rowsResult {
+	return rowsResult{
+		ColumnNames:        f.Result.ColumnNames,
+		RowCount:           f.Result.RowCount,
+		Rows:               rows,
+		TotalRowCount:      f.Result.TotalRowCount,
+		NextPageToken:      f.Result.NextPageToken,
+		TotalIsApproximate: f.Result.TotalIsApproximate,
+	}
+}
+
+func sendArrowResponse(w http.ResponseWriter, result *persistance.QueryResult) {
+	record := arrowRecord(result)
+	defer record.Release()
+	setHeaders(w, arrowStreamContentType)
+	w.Header().Set(`X-Total-Row-Count`, fmt.Sprintf(`%v`, result.TotalRowCount))
+	if result.NextPageToken != `` {
+		w.Header().Set(`X-Next-Page-Token`, result.NextPageToken)
+	}
+	_ = writeArrow(w, record)
+}
+
+func writeArrow(w io.Writer, record array.Record) error {
+	writer := ipc.NewWriter(w, ipc.WithSchema(record.Schema()))
+	err := writer.Write(record)
+	if err != nil {
+		_ = writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// arrowRecord infers each column's type from its first non-null value.
+// Columns with mixed or unknown types are sent as strings.
+func arrowRecord(result *persistance.QueryResult) array.Record {
+	fields := make([]arrow.Field, len(result.ColumnNames))
+	for index, name := range result.ColumnNames {
+		fields[index] = arrow.Field{Name: name, Type: arrowType(result.Data[index]), Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	builder := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer builder.Release()
+	for index, column := range result.Data {
+		appendArrowColumn(builder.Field(index), column)
+	}
+	return builder.NewRecord()
+}
+
+func arrowType(column []interface{}) arrow.DataType {
+	var dataType arrow.DataType
+	for _, value := range column {
+		var valueType arrow.DataType
+		switch value.(type) {
+		case nil:
+			continue
+		case float64:
+			valueType = arrow.PrimitiveTypes.Float64
+		case int64:
+			valueType = arrow.PrimitiveTypes.Int64
+		case bool:
+			valueType = arrow.FixedWidthTypes.Boolean
+		case time.Time:
+			valueType = &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: `UTC`}
+		default:
+			return arrow.BinaryTypes.String
+		}
+		if dataType != nil && !arrow.TypeEqual(dataType, valueType) {
+			return arrow.BinaryTypes.String
+		}
+		dataType = valueType
+	}
+	if dataType == nil {
+		return arrow.BinaryTypes.String
+	}
+	return dataType
+}
+
+func appendArrowColumn(builder array.Builder, column []interface{}) {
+	for _, value := range column {
+		if value == nil {
+			builder.AppendNull()
+			continue
+		}
+		switch b := builder.(type) {
+		case *array.Float64Builder:
+			b.Append(value.(float64))
+		case *array.Int64Builder:
+			b.Append(value.(int64))
+		case *array.BooleanBuilder:
+			b.Append(value.(bool))
+		case *array.TimestampBuilder:
+			b.Append(arrow.Timestamp(value.(time.Time).UnixNano()))
+		case *array.StringBuilder:
+			b.Append(exportString(value))
+		}
+	}
+}
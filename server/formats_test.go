@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"net/http/httptest"
+	"tableau_crud/persistance"
+	"testing"
+)
+
+var testQueryResult = &persistance.QueryResult{
+	ColumnNames:   []string{`KEY`, `NAME`},
+	RowCount:      2,
+	Data:          [][]interface{}{{1.0, 2.0}, {`A`, nil}},
+	TotalRowCount: 10,
+}
+
+func TestResponseFormat(t *testing.T) {
+	r := httptest.NewRequest(`POST`, `https://test.com/api/select`, nil)
+	if format, _ := responseFormat(r, ``); format != `columns` {
+		t.Fatalf(`expected columns but got %v`, format)
+	}
+	r.Header.Set(`Accept`, `application/json, application/vnd.apache.arrow.stream`)
+	if format, _ := responseFormat(r, ``); format != `arrow` {
+		t.Fatalf(`expected arrow but got %v`, format)
+	}
+	if format, _ := responseFormat(r, `rows`); format != `rows` {
+		t.Fatalf(`expected requested format to win but got %v`, format)
+	}
+	if _, err := responseFormat(r, `grid`); err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+}
+
+func TestSendRowsResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	sendNormalResponse(w, &formattedResult{Result: testQueryResult, Format: `rows`})
+	expected := `{"ColumnNames":["KEY","NAME"],"RowCount":2,"Rows":[[1,"A"],[2,null]],"TotalRowCount":10}`
+	if body := w.Body.String(); body != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, body)
+	}
+}
+
+func TestSendObjectsResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	sendNormalResponse(w, &formattedResult{Result: testQueryResult, Format: `objects`})
+	expected := `{"ColumnNames":["KEY","NAME"],"RowCount":2,"Rows":[{"KEY":1,"NAME":"A"},{"KEY":2,"NAME":null}],"TotalRowCount":10}`
+	if body := w.Body.String(); body != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, body)
+	}
+}
+
+func TestSendArrowResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	sendNormalResponse(w, &formattedResult{Result: testQueryResult, Format: `arrow`})
+	if contentType := w.Header().Get(`Content-Type`); contentType != arrowStreamContentType {
+		t.Fatalf(`expected arrow content type but got %v`, contentType)
+	}
+	reader, err := ipc.NewReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	defer reader.Release()
+	if !reader.Next() {
+		t.Fatalf(`expected a record batch`)
+	}
+	record := reader.Record()
+	if record.NumRows() != 2 || record.NumCols() != 2 {
+		t.Fatalf(`expected 2x2 record but got %vx%v`, record.NumRows(), record.NumCols())
+	}
+	keys := record.Column(0).(*array.Float64)
+	names := record.Column(1).(*array.String)
+	if keys.Value(1) != 2.0 || names.Value(0) != `A` || !names.IsNull(1) {
+		t.Fatalf(`unexpected record values %v %v`, keys, names)
+	}
+}
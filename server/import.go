@@ -0,0 +1,347 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tableau_crud/audit"
+	errorMessaging "tableau_crud/error_messaging"
+	v "tableau_crud/params_validators"
+	p "tableau_crud/persistance"
+	"time"
+)
+
+const maxImportBytes = 50 << 20
+const maxImportMemory = 8 << 20
+const defaultImportChunkSize = 500
+const maxImportChunkSize = 5000
+
+type ImportParams struct {
+	ApiKey
+	Connection string
+	Table      string
+	Format     string
+	Mapping    map[string]string
+	Upsert     bool
+	DryRun     bool
+	ChunkSize  int
+}
+
+type ImportRowError struct {
+	Row     int
+	Message string
+	Errors  []v.FieldError
+}
+
+type ImportResult struct {
+	RowCount     int
+	RowsAffected int64
+	DryRun       bool
+	Errors       []ImportRowError
+}
+
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	clearWriteDeadline(w)
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	err := r.ParseMultipartForm(maxImportMemory)
+	if err != nil {
+		sendErrorResponse(w, newApiError(http.StatusBadRequest, `invalid_upload`, fmt.Sprintf(`error reading upload: %v`, err.Error())))
+		return
+	}
+	defer func() {
+		_ = r.MultipartForm.RemoveAll()
+	}()
+	params := ImportParams{}
+	err = json.Unmarshal([]byte(r.FormValue(`params`)), &params)
+	if err != nil {
+		sendErrorResponse(w, invalidField(`params`, `error decoding import params`, err))
+		return
+	}
+	err = s.authenticatePayload(&params)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	persistor, err := s.getPersistor(params.Connection)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `import`)
+	defer cancel()
+	table := s.getTable(params.Connection, params.Table)
+	if params.Upsert && len(table.KeyFields) == 0 {
+		sendErrorResponse(w, invalidField(`Upsert`, `invalid import`, fmt.Errorf(`table %q must have key fields to upsert`, params.Table)))
+		return
+	}
+	if params.ChunkSize <= 0 {
+		params.ChunkSize = defaultImportChunkSize
+	}
+	if params.ChunkSize > maxImportChunkSize {
+		params.ChunkSize = maxImportChunkSize
+	}
+
+	file, header, err := r.FormFile(`file`)
+	if err != nil {
+		sendErrorResponse(w, invalidField(`file`, `error reading uploaded file`, err))
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if params.Format == `` {
+		params.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), `.`)
+	}
+	records, err := readImportRecords(file, params.Format)
+	if err != nil {
+		sendErrorResponse(w, invalidField(`file`, `error reading uploaded file`, err))
+		return
+	}
+
+	rows, result, err := table.prepareImport(ctx, persistor, records, params, time.Now())
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error validating records`, err))
+		return
+	}
+	result.DryRun = params.DryRun
+	if params.DryRun || len(result.Errors) > 0 {
+		sendNormalResponse(w, result)
+		return
+	}
+	result.RowsAffected, err = table.importRows(ctx, persistor, rows, params)
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error importing records`, err))
+		return
+	}
+	s.recordAudit(r, params.User, audit.Entry{
+		Connection:   params.Connection,
+		Table:        params.Table,
+		Operation:    `import`,
+		RowsAffected: result.RowsAffected,
+	})
+	sendNormalResponse(w, result)
+}
+
+func readImportRecords(file io.ReadSeeker, format string) ([][]string, error) {
+	switch format {
+	case `csv`:
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		return reader.ReadAll()
+	case `xlsx`:
+		workbook, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, fmt.Errorf(`error reading xlsx file: %v`, err.Error())
+		}
+		defer func() {
+			_ = workbook.Close()
+		}()
+		return workbook.GetRows(workbook.GetSheetName(0))
+	default:
+		return nil, fmt.Errorf(`invalid import format %q, expected 'csv' or 'xlsx'`, format)
+	}
+}
+
+// prepareImport maps, defaults and validates every record. Row numbers in
+// the report are 1-based and count the header row, matching the spreadsheet.
+// Lookups are checked a chunk at a time.
+func (t Table) prepareImport(ctx context.Context, persistor p.Persistor, records [][]string, params ImportParams, now time.Time) ([]map[string]interface{}, *ImportResult, error) {
+	result := &ImportResult{Errors: make([]ImportRowError, 0)}
+	if len(records) == 0 {
+		result.Errors = append(result.Errors, ImportRowError{Row: 1, Message: `the file does not have a header row`})
+		return nil, result, nil
+	}
+	columns := importColumns(records[0], params.Mapping)
+	if err := t.checkImportColumns(columns); err != nil {
+		result.Errors = append(result.Errors, ImportRowError{Row: 1, Message: `the file has columns that cannot be imported`, Errors: err.Errors})
+		return nil, result, nil
+	}
+	chunkSize := params.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultImportChunkSize
+	}
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	keyRows := make(map[string]int)
+	for start := 1; start < len(records); start += chunkSize {
+		end := start + chunkSize
+		if end > len(records) {
+			end = len(records)
+		}
+		chunk := make([]map[string]interface{}, 0, end-start)
+		rowNumbers := make([]int, 0, end-start)
+		for index, record := range records[start:end] {
+			rowNumber := start + index + 1
+			values, err := t.applyDefaults(importValues(columns, record))
+			if err != nil {
+				result.Errors = append(result.Errors, importRowError(rowNumber, err))
+				continue
+			}
+			chunk = append(chunk, values)
+			rowNumbers = append(rowNumbers, rowNumber)
+		}
+		checkLookup, err := t.batchLookupChecker(ctx, persistor, chunk)
+		if err != nil {
+			return nil, nil, err
+		}
+		for index, values := range chunk {
+			err = t.validateWith(values, true, checkLookup)
+			if err == nil {
+				values, err = t.ManagedColumns.ApplyToInsert(values, params.User, now)
+			}
+			if err == nil {
+				err = t.checkDuplicateKey(keyRows, values, rowNumbers[index])
+			}
+			if err != nil {
+				result.Errors = append(result.Errors, importRowError(rowNumbers[index], err))
+				continue
+			}
+			rows = append(rows, values)
+		}
+	}
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Row < result.Errors[j].Row
+	})
+	result.RowCount = len(records) - 1
+	return rows, result, nil
+}
+
+func importValues(columns []string, record []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(columns))
+	for column, field := range columns {
+		if field == `` {
+			continue
+		}
+		if column < len(record) && record[column] != `` {
+			values[field] = record[column]
+			continue
+		}
+		values[field] = nil
+	}
+	return values
+}
+
+// checkImportColumns rejects files that set the soft delete columns, which
+// would otherwise let an import restore deleted rows.
+func (t Table) checkImportColumns(columns []string) *v.ValidationError {
+	if !t.IsSoftDelete() {
+		return nil
+	}
+	fieldErrors := make([]v.FieldError, 0)
+	for _, field := range columns {
+		if field != `` && (field == t.SoftDelete.Column || field == t.SoftDelete.DeletedBy) {
+			fieldErrors = append(fieldErrors, v.FieldError{Field: field, Rule: `soft_delete`, Message: `is maintained by soft delete and cannot be imported`})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return &v.ValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+// checkDuplicateKey rejects a row whose key values were already used by an
+// earlier row of the file. Rows with a missing key value are not compared.
+func (t Table) checkDuplicateKey(keyRows map[string]int, values map[string]interface{}, rowNumber int) error {
+	if len(t.KeyFields) == 0 {
+		return nil
+	}
+	for _, field := range t.KeyFields {
+		if values[field] == nil {
+			return nil
+		}
+	}
+	key := p.KeyString(t.KeyFields, values)
+	if first, ok := keyRows[key]; ok {
+		return fmt.Errorf(`has the same key values as row %v`, first)
+	}
+	keyRows[key] = rowNumber
+	return nil
+}
+
+func importColumns(header []string, mapping map[string]string) []string {
+	columns := make([]string, len(header))
+	for index, name := range header {
+		name = strings.TrimSpace(name)
+		if mapped, ok := mapping[name]; ok {
+			columns[index] = mapped
+			continue
+		}
+		columns[index] = name
+	}
+	return columns
+}
+
+func importRowError(row int, err error) ImportRowError {
+	if validationErr, ok := err.(*v.ValidationError); ok {
+		return ImportRowError{Row: row, Message: `row is not valid`, Errors: validationErr.Errors}
+	}
+	return ImportRowError{Row: row, Message: err.Error()}
+}
+
+func (t Table) importRows(ctx context.Context, persistor p.Persistor, rows []map[string]interface{}, params ImportParams) (int64, error) {
+	write := func(tx p.Transaction, chunk []map[string]interface{}) (int64, error) {
+		if params.Upsert {
+			return tx.Merge(params.Table, t.KeyFields, t.ManagedColumns.InsertOnly(), chunk)
+		}
+		return tx.InsertMany(params.Table, chunk)
+	}
+	tx, err := persistor.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for start := 0; start < len(rows); start += params.ChunkSize {
+		end := start + params.ChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		var result int64
+		if params.Upsert && t.IsSoftDelete() {
+			err = t.checkNotDeleted(tx, rows[start:end], start+2)
+			if err != nil {
+				_ = tx.Rollback()
+				return 0, err
+			}
+		}
+		if recorder := t.recorder(params.User); recorder != nil {
+			result, err = recorder.Import(tx, rows[start:end], func(chunk []map[string]interface{}) (int64, error) {
+				return write(tx, chunk)
+			})
+		} else {
+			result, err = write(tx, rows[start:end])
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, fmt.Errorf(`rows %v to %v: %w`, start+2, end+1, err)
+		}
+		total += result
+	}
+	return total, tx.Commit()
+}
+
+// checkNotDeleted rejects upserting rows whose keys match soft deleted rows,
+// which would otherwise bring the deleted rows back.
+func (t Table) checkNotDeleted(tx p.Transaction, rows []map[string]interface{}, firstRow int) error {
+	keys := &p.KeysClause{Identifiers: t.KeyFields, Values: p.KeyValues(t.KeyFields, rows)}
+	deleted, err := tx.Select(t.Name, []p.SqlSnippetGenerator{keys, t.deletedClause()})
+	if err != nil {
+		return err
+	}
+	if deleted.RowCount == 0 {
+		return nil
+	}
+	deletedRows := p.NewRowIndex(t.KeyFields, deleted.Rows())
+	rowNumbers := make([]int, 0, deleted.RowCount)
+	for index, row := range rows {
+		if _, ok := deletedRows.Get(row); ok {
+			rowNumbers = append(rowNumbers, firstRow+index)
+		}
+	}
+	return errorMessaging.UserErrorf(`rows %v match deleted rows and cannot be upserted`, rowNumbers)
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"strings"
+	v "tableau_crud/params_validators"
+	p "tableau_crud/persistance"
+	"testing"
+	"time"
+)
+
+func TestReadImportRecordsCsv(t *testing.T) {
+	records, err := readImportRecords(strings.NewReader("Key,Name\n1,A\n2\n"), `csv`)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(records) != 3 || len(records[2]) != 1 {
+		t.Fatalf(`expected 3 records with a short last row but got %v`, records)
+	}
+}
+
+func TestReadImportRecordsInvalidFormat(t *testing.T) {
+	_, err := readImportRecords(strings.NewReader(``), `txt`)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+}
+
+func TestPrepareImport(t *testing.T) {
+	table := Table{
+		Name:           `TARGETS`,
+		Columns:        map[string]v.ColumnRule{`NAME`: {Required: true}},
+		ManagedColumns: v.ManagedColumns{CreatedBy: `CREATED_BY`},
+	}
+	records := [][]string{
+		{`Key`, `Target Name`, `Notes`},
+		{`1`, `A`, `ignored`},
+		{`2`, ``, `ignored`},
+	}
+	mapping := map[string]string{`Key`: `KEY`, `Target Name`: `NAME`, `Notes`: ``}
+	params := ImportParams{ApiKey: ApiKey{User: `me`}, Mapping: mapping}
+	rows, result, err := table.prepareImport(context.Background(), nil, records, params, time.Now())
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if result.RowCount != 2 || len(rows) != 1 {
+		t.Fatalf(`expected 1 of 2 rows to be valid but got %v of %v`, len(rows), result.RowCount)
+	}
+	if rows[0][`KEY`] != `1` || rows[0][`CREATED_BY`] != `me` {
+		t.Fatalf(`expected mapped row with managed columns but got %v`, rows[0])
+	}
+	if _, ok := rows[0][`Notes`]; ok {
+		t.Fatalf(`expected unmapped column to be skipped but got %v`, rows[0])
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Row != 3 || result.Errors[0].Errors[0].Rule != `required` {
+		t.Fatalf(`expected a required error on row 3 but got %v`, result.Errors)
+	}
+}
+
+type lookupPersistor struct {
+	p.Persistor
+	queries []p.DistinctQuery
+	values  []interface{}
+}
+
+func (l *lookupPersistor) Distinct(_ context.Context, query p.DistinctQuery) (*p.QueryResult, error) {
+	l.queries = append(l.queries, query)
+	return &p.QueryResult{ColumnNames: []string{query.Column}, RowCount: len(l.values), Data: [][]interface{}{l.values}}, nil
+}
+
+func TestPrepareImportChecksLookupsPerChunk(t *testing.T) {
+	table := Table{
+		Name:    `TARGETS`,
+		Columns: map[string]v.ColumnRule{`REGION`: {Lookup: &v.Lookup{Table: `REGIONS`, Column: `CODE`}}},
+	}
+	records := [][]string{{`KEY`, `REGION`}, {`1`, `N`}, {`2`, `S`}, {`3`, `N`}, {`4`, `X`}}
+	persistor := &lookupPersistor{values: []interface{}{`N`, `S`}}
+	rows, result, err := table.prepareImport(context.Background(), persistor, records, ImportParams{ChunkSize: 3}, time.Now())
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(persistor.queries) != 2 {
+		t.Fatalf(`expected 1 lookup query per chunk but got %v`, len(persistor.queries))
+	}
+	if values := persistor.queries[0].Where[0].(*p.InClause).Values; len(values) != 2 {
+		t.Fatalf(`expected the distinct values of the first chunk but got %v`, values)
+	}
+	if len(rows) != 3 || len(result.Errors) != 1 || result.Errors[0].Row != 5 {
+		t.Fatalf(`expected a lookup error on row 5 but got %v`, result.Errors)
+	}
+}
+
+func TestPrepareImportRejectsDuplicateKeys(t *testing.T) {
+	table := Table{Name: `TARGETS`, KeyFields: []string{`KEY`}}
+	records := [][]string{{`KEY`, `NAME`}, {`1`, `A`}, {`2`, `B`}, {`1`, `C`}, {``, `D`}, {``, `E`}}
+	rows, result, err := table.prepareImport(context.Background(), nil, records, ImportParams{ChunkSize: 2}, time.Now())
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(rows) != 4 || len(result.Errors) != 1 || result.Errors[0].Row != 4 {
+		t.Fatalf(`expected a duplicate key error on row 4 but got %v`, result.Errors)
+	}
+	t.Log(result.Errors[0].Message)
+}
+
+func TestPrepareImportRejectsSoftDeleteColumns(t *testing.T) {
+	table := Table{Name: `TARGETS`, SoftDelete: SoftDelete{Column: `IS_DELETED`, Type: `flag`}}
+	records := [][]string{{`KEY`, `IS_DELETED`}, {`1`, ``}}
+	rows, result, err := table.prepareImport(context.Background(), nil, records, ImportParams{}, time.Now())
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(rows) != 0 || len(result.Errors) != 1 || result.Errors[0].Errors[0].Rule != `soft_delete` {
+		t.Fatalf(`expected a soft delete error but got %v`, result.Errors)
+	}
+}
+
+type deletedTx struct {
+	p.Transaction
+	deleted []interface{}
+	where   []p.SqlSnippetGenerator
+}
+
+func (d *deletedTx) Select(_ string, where []p.SqlSnippetGenerator) (*p.QueryResult, error) {
+	d.where = where
+	return &p.QueryResult{ColumnNames: []string{`KEY`}, RowCount: len(d.deleted), Data: [][]interface{}{d.deleted}}, nil
+}
+
+func TestCheckNotDeleted(t *testing.T) {
+	table := Table{Name: `TARGETS`, KeyFields: []string{`KEY`}, SoftDelete: SoftDelete{Column: `IS_DELETED`, Type: `flag`}}
+	tx := &deletedTx{deleted: []interface{}{2000000.0}}
+	rows := []map[string]interface{}{{`KEY`: `1000000`}, {`KEY`: `2000000`}}
+	err := table.checkNotDeleted(tx, rows, 10)
+	if err == nil || !strings.Contains(err.Error(), `[11]`) {
+		t.Fatalf(`expected row 11 to be rejected but got %v`, err)
+	}
+	if len(tx.where) != 2 {
+		t.Fatalf(`expected a key and deleted filter but got %v`, tx.where)
+	}
+}
+
+func TestPrepareImportMatchesNumericLookupValues(t *testing.T) {
+	table := Table{
+		Name:    `TARGETS`,
+		Columns: map[string]v.ColumnRule{`CODE`: {Lookup: &v.Lookup{Table: `DATES`, Column: `CODE`}}},
+	}
+	records := [][]string{{`CODE`}, {`20240101`}, {`20240102`}}
+	persistor := &lookupPersistor{values: []interface{}{20240101.0}}
+	rows, result, err := table.prepareImport(context.Background(), persistor, records, ImportParams{}, time.Now())
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(rows) != 1 || len(result.Errors) != 1 || result.Errors[0].Row != 3 {
+		t.Fatalf(`expected only row 3 to be rejected but got %v`, result.Errors)
+	}
+}
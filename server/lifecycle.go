@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultReadHeaderTimeout = 10
+	defaultReadTimeout       = 120
+	defaultWriteTimeout      = 300
+	defaultIdleTimeout       = 120
+	defaultShutdownTimeout   = 30
+)
+
+// Timeouts are in seconds. Zero uses the default; a negative value disables
+// the timeout.
+type Timeouts struct {
+	ReadHeader int
+	Read       int
+	Write      int
+	Idle       int
+	Shutdown   int
+}
+
+func (t Timeouts) ShutdownTimeout() time.Duration {
+	return timeoutOrDefault(t.Shutdown, defaultShutdownTimeout)
+}
+
+func timeoutOrDefault(seconds int, defaultSeconds int) time.Duration {
+	if seconds < 0 {
+		return 0
+	}
+	if seconds == 0 {
+		seconds = defaultSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func (s *Server) HttpServer() *http.Server {
+	timeouts := s.Settings.Timeouts
+	return &http.Server{
+		Addr:              s.Settings.Address,
+		Handler:           s.Handler,
+		ReadHeaderTimeout: timeoutOrDefault(timeouts.ReadHeader, defaultReadHeaderTimeout),
+		ReadTimeout:       timeoutOrDefault(timeouts.Read, defaultReadTimeout),
+		WriteTimeout:      timeoutOrDefault(timeouts.Write, defaultWriteTimeout),
+		IdleTimeout:       timeoutOrDefault(timeouts.Idle, defaultIdleTimeout),
+	}
+}
+
+// clearWriteDeadline lifts the server's Write timeout for a request that may
+// run longer than it, such as a streamed export or a large import. The upload
+// is still bounded by the Read timeout and the database work by the operation
+// timeout.
+func clearWriteDeadline(w http.ResponseWriter) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
+// Close releases the audit sink and every connection pool. It keeps going
+// after a failure so that one bad connection does not leak the others. It
+// waits for a running reload and prevents any further reload.
+func (s *Server) Close() error {
+	s.reloading.Lock()
+	s.closed = true
+	s.reloading.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	errs := make([]error, 0)
+	if s.Audit != nil {
+		if err := s.Audit.Close(); err != nil {
+			errs = append(errs, fmt.Errorf(`error closing audit sink: %w`, err))
+		}
+	}
+	for name, persistor := range s.Persistors {
+		if err := persistor.Close(); err != nil {
+			errs = append(errs, fmt.Errorf(`error closing connection %q: %w`, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
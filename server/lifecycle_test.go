@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"tableau_crud/persistance"
+	"testing"
+	"time"
+)
+
+type closingPersistor struct {
+	persistance.Persistor
+	closed bool
+	err    error
+}
+
+func (c *closingPersistor) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestServerCloseClosesAllPersistors(t *testing.T) {
+	failing := &closingPersistor{err: errors.New(`close failed`)}
+	working := &closingPersistor{}
+	s := &Server{Persistors: map[string]persistance.Persistor{`a`: failing, `b`: working}}
+	err := s.Close()
+	if !failing.closed || !working.closed {
+		t.Fatalf(`expected every persistor to be closed`)
+	}
+	if err == nil {
+		t.Fatalf(`expected close error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestHttpServerTimeouts(t *testing.T) {
+	s := &Server{Settings: Settings{Address: `localhost:0`, Timeouts: Timeouts{Read: 5, Write: -1}}}
+	httpServer := s.HttpServer()
+	if httpServer.ReadTimeout != 5*time.Second {
+		t.Fatalf(`expected configured read timeout but got %v`, httpServer.ReadTimeout)
+	}
+	if httpServer.WriteTimeout != 0 {
+		t.Fatalf(`expected disabled write timeout but got %v`, httpServer.WriteTimeout)
+	}
+	if httpServer.ReadHeaderTimeout != defaultReadHeaderTimeout*time.Second {
+		t.Fatalf(`expected default read header timeout but got %v`, httpServer.ReadHeaderTimeout)
+	}
+}
+
+func TestClearWriteDeadlineOutlivesWriteTimeout(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clearWriteDeadline(w)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`done`))
+	}))
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, err := io.ReadAll(response.Body)
+	if err != nil || string(body) != `done` {
+		t.Fatalf(`expected the full response but got '%s', %v`, body, err)
+	}
+}
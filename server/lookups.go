@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	v "tableau_crud/params_validators"
+	p "tableau_crud/persistance"
+)
+
+const defaultLookupPageSize = 100
+const maxLookupPageSize = 1000
+
+type LookupParams struct {
+	ApiKey
+	Connection string
+	Table      string
+	Column     string
+	Search     string
+	PageSize   int
+	Page       int
+}
+
+type LookupResult struct {
+	Values        []v.LookupValue
+	TotalRowCount int
+}
+
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	params, err := validatePayload[LookupParams](s, r)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	persistor, err := s.getPersistor(params.Connection)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `lookup`)
+	defer cancel()
+	rule, ok := s.getTable(params.Connection, params.Table).Columns[params.Column]
+	if !ok || rule.Lookup == nil {
+		sendErrorResponse(w, notFound(`lookup_not_found`, `column %q of table %q does not have a lookup`, params.Column, params.Table))
+		return
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = defaultLookupPageSize
+	}
+	if params.PageSize > maxLookupPageSize {
+		sendErrorResponse(w, newApiError(http.StatusBadRequest, `invalid_page_size`, fmt.Sprintf(`PageSize must be at most %v`, maxLookupPageSize)))
+		return
+	}
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	var result *LookupResult
+	if rule.Lookup.IsStatic() {
+		result = readStaticLookup(rule.Lookup, params.Search, params.PageSize, params.Page)
+	} else {
+		result, err = readTableLookup(ctx, persistor, rule.Lookup, params.Search, params.PageSize, params.Page)
+		if err != nil {
+			sendErrorResponse(w, databaseError(`error reading lookup values`, err))
+			return
+		}
+	}
+	sendNormalResponse(w, result)
+}
+
+func readStaticLookup(lookup *v.Lookup, search string, pageSize int, page int) *LookupResult {
+	search = strings.ToLower(search)
+	matches := make([]v.LookupValue, 0, len(lookup.Values))
+	for _, value := range lookup.Values {
+		if value.Label == `` {
+			value.Label = fmt.Sprintf(`%v`, value.Value)
+		}
+		if search == `` || strings.Contains(strings.ToLower(value.Label), search) || strings.Contains(strings.ToLower(fmt.Sprintf(`%v`, value.Value)), search) {
+			matches = append(matches, value)
+		}
+	}
+	start := (page - 1) * pageSize
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + pageSize
+	if end > len(matches) {
+		end = len(matches)
+	}
+	return &LookupResult{Values: matches[start:end], TotalRowCount: len(matches)}
+}
+
+func readTableLookup(ctx context.Context, persistor p.Persistor, lookup *v.Lookup, search string, pageSize int, page int) (*LookupResult, error) {
+	fields := []string{lookup.Column}
+	orderBy := []string{lookup.Column}
+	if lookup.LabelColumn != `` {
+		fields = append(fields, lookup.LabelColumn)
+		orderBy = []string{lookup.LabelColumn, lookup.Column}
+	}
+	where := make([]p.SqlSnippetGenerator, 0, 1)
+	if search != `` {
+		where = append(where, &p.SearchClause{Identifiers: fields, Text: search})
+	}
+	data, err := persistor.Read(ctx, p.ReadQuery{Table: lookup.Table, Fields: fields, Where: where, OrderBy: orderBy, PageSize: pageSize, Page: page, IncludeTotal: true, Distinct: true})
+	if err != nil {
+		return nil, err
+	}
+	result := &LookupResult{Values: make([]v.LookupValue, data.RowCount), TotalRowCount: data.TotalRowCount}
+	for index := range result.Values {
+		value := data.Data[0][index]
+		label := fmt.Sprintf(`%v`, value)
+		if len(data.Data) > 1 && data.Data[1][index] != nil {
+			label = fmt.Sprintf(`%v`, data.Data[1][index])
+		}
+		result.Values[index] = v.LookupValue{Value: value, Label: label}
+	}
+	return result, nil
+}
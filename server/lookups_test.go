@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	v "tableau_crud/params_validators"
+	p "tableau_crud/persistance"
+	"testing"
+)
+
+var testLookup = &v.Lookup{Values: []v.LookupValue{
+	{Value: `Project`, Label: `Project`},
+	{Value: `Task`},
+	{Value: `PRJ-2`, Label: `Sub-project`},
+}}
+
+func TestStaticLookupSearch(t *testing.T) {
+	result := readStaticLookup(testLookup, `proj`, 10, 1)
+	if result.TotalRowCount != 2 {
+		t.Fatalf(`expected 2 matches but got %v`, result.TotalRowCount)
+	}
+	if result.Values[1].Label != `Sub-project` {
+		t.Fatalf(`expected Sub-project but got %v`, result.Values[1].Label)
+	}
+}
+
+func TestStaticLookupPaging(t *testing.T) {
+	result := readStaticLookup(testLookup, ``, 2, 2)
+	if result.TotalRowCount != 3 || len(result.Values) != 1 {
+		t.Fatalf(`expected 1 of 3 values but got %v of %v`, len(result.Values), result.TotalRowCount)
+	}
+	if result.Values[0].Value != `PRJ-2` {
+		t.Fatalf(`expected PRJ-2 but got %v`, result.Values[0].Value)
+	}
+	result = readStaticLookup(testLookup, ``, 2, 5)
+	if len(result.Values) != 0 {
+		t.Fatalf(`expected no values past the last page but got %v`, result.Values)
+	}
+}
+
+func TestStaticLookupDefaultsLabelToValue(t *testing.T) {
+	result := readStaticLookup(testLookup, `task`, 10, 1)
+	if len(result.Values) != 1 || result.Values[0].Label != `Task` {
+		t.Fatalf(`expected Task label but got %v`, result.Values)
+	}
+}
+
+type lookupReadPersistor struct {
+	p.Persistor
+	query p.ReadQuery
+}
+
+func (l *lookupReadPersistor) Read(_ context.Context, query p.ReadQuery) (*p.QueryResult, error) {
+	l.query = query
+	return &p.QueryResult{ColumnNames: []string{`CODE`}, RowCount: 1, Data: [][]interface{}{{`N`}}, TotalRowCount: 1}, nil
+}
+
+func TestTableLookupReadsDistinctValues(t *testing.T) {
+	persistor := &lookupReadPersistor{}
+	result, err := readTableLookup(context.Background(), persistor, &v.Lookup{Table: `REGIONS`, Column: `CODE`}, ``, 10, 1)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if !persistor.query.Distinct || len(result.Values) != 1 {
+		t.Fatalf(`expected a distinct read but got %+v`, persistor.query)
+	}
+}
+
+func TestLookupRejectsLargePageSize(t *testing.T) {
+	lookup := v.ColumnRule{Lookup: &v.Lookup{Table: `REGIONS`, Column: `CODE`}}
+	s := &Server{
+		Settings:   Settings{ApiKey: `12345`, Connections: []Connection{{Name: `test`, Tables: []Table{{Name: `T`, Columns: map[string]v.ColumnRule{`REGION`: lookup}}}}}},
+		Persistors: map[string]p.Persistor{`test`: &lookupReadPersistor{}},
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(`POST`, `/api/lookup`, strings.NewReader(`{"ApiKey":"12345","Connection":"test","Table":"T","Column":"REGION","PageSize":100000}`))
+	s.handleLookup(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `invalid_page_size`) {
+		t.Fatalf(`expected invalid_page_size but got %v %v`, w.Code, w.Body.String())
+	}
+}
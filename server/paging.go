@@ -0,0 +1,45 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const maxPageSize = 10000
+
+// checkPaging rejects page sizes that would read nothing or a whole table.
+// Page is ignored when paging with a token.
+func checkPaging(pageSize int, page int, keyset bool) error {
+	if pageSize < 1 || pageSize > maxPageSize {
+		return newApiError(http.StatusBadRequest, `invalid_page_size`, fmt.Sprintf(`PageSize must be between 1 and %v`, maxPageSize))
+	}
+	if !keyset && page < 1 {
+		return newApiError(http.StatusBadRequest, `invalid_page`, `Page must be at least 1`)
+	}
+	return nil
+}
+
+// keysetOrder appends the table's key fields to the order and the selected
+// fields so that the order is unique and no row is skipped at a page
+// boundary when several rows share the same sort values.
+func (t Table) keysetOrder(fields []string, orderBy []string) ([]string, []string, error) {
+	if len(t.KeyFields) == 0 {
+		return nil, nil, newApiError(http.StatusBadRequest, `keyset_unavailable`, fmt.Sprintf(`paging with a token requires KeyFields to be configured for table %q`, t.Name))
+	}
+	return appendMissing(fields, t.KeyFields), appendMissing(orderBy, t.KeyFields), nil
+}
+
+func appendMissing(fields []string, required []string) []string {
+	present := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		present[field] = true
+	}
+	result := append([]string{}, fields...)
+	for _, field := range required {
+		if !present[field] {
+			result = append(result, field)
+			present[field] = true
+		}
+	}
+	return result
+}
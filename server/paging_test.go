@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"tableau_crud/persistance"
+	"testing"
+)
+
+func TestCheckPaging(t *testing.T) {
+	for _, pageSize := range []int{0, -1, maxPageSize + 1} {
+		var apiErr *ApiError
+		if err := checkPaging(pageSize, 1, true); !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+			t.Fatalf(`expected 400 for page size %v but got %v`, pageSize, err)
+		}
+	}
+	if err := checkPaging(10, 0, false); err == nil {
+		t.Fatalf(`expected error for page 0`)
+	}
+	if err := checkPaging(10, 0, true); err != nil {
+		t.Fatalf(`expected page to be ignored with a token but got %v`, err)
+	}
+}
+
+func TestKeysetOrderAppendsKeyFields(t *testing.T) {
+	table := Table{Name: `orders`, KeyFields: []string{`ID`}}
+	fields, orderBy, err := table.keysetOrder([]string{`NAME`}, []string{`NAME`})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if !reflect.DeepEqual(fields, []string{`NAME`, `ID`}) || !reflect.DeepEqual(orderBy, []string{`NAME`, `ID`}) {
+		t.Fatalf(`expected key field to be appended but got %v and %v`, fields, orderBy)
+	}
+	_, _, err = Table{Name: `orders`}.keysetOrder([]string{`NAME`}, []string{`NAME`})
+	if err == nil {
+		t.Fatalf(`expected error for a table without KeyFields`)
+	}
+}
+
+func TestReadRejectsZeroPageSize(t *testing.T) {
+	s := &Server{Settings: Settings{ApiKey: `12345`}, Persistors: map[string]persistance.Persistor{`test`: &closingPersistor{}}}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(`POST`, `/api/select`, strings.NewReader(`{"ApiKey":"12345","Connection":"test","Table":"T","Fields":["A"],"OrderBy":["A"],"Keyset":true,"PageSize":0}`))
+	s.handleRead(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf(`expected 400 but got %v`, w.Code)
+	}
+}
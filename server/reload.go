@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"tableau_crud/audit"
+	"tableau_crud/persistance"
+	"time"
+)
+
+// current serves each request from a snapshot of the settings, persistors
+// and audit sink, so that a reload never changes them mid-request. The
+// request holds a reference to every pool in its snapshot so that a pool
+// removed by any later reload is only closed once no request uses it.
+func (s *Server) current(handler func(*Server, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.lock.RLock()
+		snapshot := &Server{
+			Settings:   s.Settings,
+			Handler:    s.Handler,
+			Persistors: s.Persistors,
+			Audit:      s.Audit,
+			HtmlPath:   s.HtmlPath,
+		}
+		resources := snapshot.resources()
+		s.acquire(resources)
+		s.lock.RUnlock()
+		defer s.release(resources)
+		handler(snapshot, w, r)
+	}
+}
+
+func (s *Server) resources() []io.Closer {
+	resources := make([]io.Closer, 0, len(s.Persistors)+1)
+	for _, persistor := range s.Persistors {
+		resources = append(resources, persistor)
+	}
+	if s.Audit != nil {
+		resources = append(resources, s.Audit)
+	}
+	return resources
+}
+
+func (s *Server) acquire(resources []io.Closer) {
+	s.referencesLock.Lock()
+	defer s.referencesLock.Unlock()
+	if s.references == nil {
+		s.references = make(map[io.Closer]int)
+	}
+	for _, resource := range resources {
+		s.references[resource]++
+	}
+}
+
+func (s *Server) release(resources []io.Closer) {
+	s.referencesLock.Lock()
+	defer s.referencesLock.Unlock()
+	for _, resource := range resources {
+		s.references[resource]--
+		if s.references[resource] > 0 {
+			continue
+		}
+		delete(s.references, resource)
+		if s.retired[resource] {
+			delete(s.retired, resource)
+			closeRetired(resource)
+		}
+	}
+}
+
+// retire closes resources that no request uses and marks the rest to be
+// closed by the last request that releases them.
+func (s *Server) retire(resources []io.Closer) {
+	s.referencesLock.Lock()
+	defer s.referencesLock.Unlock()
+	if s.retired == nil {
+		s.retired = make(map[io.Closer]bool)
+	}
+	for _, resource := range resources {
+		if s.references[resource] > 0 {
+			s.retired[resource] = true
+			continue
+		}
+		closeRetired(resource)
+	}
+}
+
+func closeRetired(resource io.Closer) {
+	if err := resource.Close(); err != nil {
+		log.Printf(`error closing removed connection or audit sink: %v`, err.Error())
+	}
+}
+
+// Reload reads the settings file again and swaps in the new settings. A
+// connection whose database settings did not change keeps its pool; removed
+// or changed connections are closed once the requests using them finish. An
+// invalid file is rejected and the running settings are kept.
+func (s *Server) Reload() error {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	if s.closed {
+		return errors.New(`the server is shutting down`)
+	}
+	settings, err := loadSettings(s.settingsPath)
+	if err != nil {
+		return err
+	}
+	if problems := settings.problems(); len(problems) > 0 {
+		return errors.Join(problems...)
+	}
+
+	s.lock.RLock()
+	previous := s.Settings
+	previousPersistors := s.Persistors
+	previousAudit := s.Audit
+	s.lock.RUnlock()
+
+	persistors := make(map[string]persistance.Persistor, len(settings.Connections))
+	opened := make([]persistance.Persistor, 0)
+	closeOpened := func() {
+		for _, persistor := range opened {
+			_ = persistor.Close()
+		}
+	}
+	for _, conn := range settings.Connections {
+		name := strings.ToLower(conn.Name)
+		if existing, ok := previousPersistors[name]; ok && sameDatabase(previous.connection(name), conn) {
+			persistors[name] = existing
+			continue
+		}
+		persistor, err := openPersistor(conn)
+		if err != nil {
+			closeOpened()
+			return fmt.Errorf(`error opening connection %q: %w`, conn.Name, err)
+		}
+		opened = append(opened, persistor)
+		persistors[name] = persistor
+	}
+	sink := previousAudit
+	auditChanged := previous.Audit != settings.Audit || persistors[strings.ToLower(settings.Audit.Connection)] != previousPersistors[strings.ToLower(previous.Audit.Connection)]
+	if auditChanged {
+		sink, err = audit.NewSink(settings.Audit, persistors)
+		if err != nil {
+			closeOpened()
+			return err
+		}
+	}
+
+	retired := make([]io.Closer, 0)
+	for name, persistor := range previousPersistors {
+		if persistors[name] != persistor {
+			retired = append(retired, persistor)
+		}
+	}
+	if auditChanged && previousAudit != nil {
+		retired = append(retired, previousAudit)
+	}
+	if previous.Address != settings.Address || previous.UseTls != settings.UseTls || previous.Timeouts != settings.Timeouts {
+		log.Printf(`Address, UseTls and Timeouts changes take effect after a restart`)
+	}
+
+	s.lock.Lock()
+	s.Settings = settings
+	s.Persistors = persistors
+	s.Audit = sink
+	s.lock.Unlock()
+
+	s.retire(retired)
+	return nil
+}
+
+// WatchSettings polls the settings file and reloads it whenever it changes
+// until ctx is cancelled.
+func (s *Server) WatchSettings(ctx context.Context, interval time.Duration) {
+	modified := settingsModified(s.settingsPath)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		latest := settingsModified(s.settingsPath)
+		if latest.Equal(modified) {
+			continue
+		}
+		modified = latest
+		s.reloadAndLog(`settings file changed`)
+	}
+}
+
+func (s *Server) reloadAndLog(reason string) {
+	err := s.Reload()
+	if err != nil {
+		log.Printf(`%v, reload rejected: %v`, reason, err.Error())
+		return
+	}
+	log.Printf(`%v, settings reloaded`, reason)
+}
+
+func settingsModified(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (s Settings) connection(name string) Connection {
+	for _, conn := range s.Connections {
+		if strings.ToLower(conn.Name) == name {
+			return conn
+		}
+	}
+	return Connection{}
+}
+
+// sameDatabase reports whether the existing pool of a connection can be kept.
+// Table settings are read per request and do not require a new pool.
+func sameDatabase(a Connection, b Connection) bool {
+	a.Name, a.Tables, a.OperationTimeouts = ``, nil, nil
+	b.Name, b.Tables, b.OperationTimeouts = ``, nil, nil
+	return reflect.DeepEqual(a, b)
+}
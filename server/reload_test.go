@@ -0,0 +1,178 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"tableau_crud/persistance"
+	"testing"
+)
+
+func writeReloadSettings(t *testing.T, path string, content string) {
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+}
+
+func TestReloadSwapsSettingsAfterInFlightRequests(t *testing.T) {
+	opened := map[string]*closingPersistor{}
+	original := openPersistor
+	openPersistor = func(conn Connection) (persistance.Persistor, error) {
+		persistor := &closingPersistor{}
+		opened[conn.ConnStr] = persistor
+		return persistor, nil
+	}
+	defer func() { openPersistor = original }()
+
+	path := filepath.Join(t.TempDir(), `server.json`)
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"old","Connections":[`+
+		`{"Name":"kept","Driver":"snowflake","ConnStr":"kept"},`+
+		`{"Name":"removed","Driver":"snowflake","ConnStr":"removed"}]}`)
+	s, err := LoadServer(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	seenApiKey := make(chan string, 1)
+	handler := s.current(func(snapshot *Server, _ http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		seenApiKey <- snapshot.Settings.ApiKey
+	})
+	done := make(chan struct{})
+	go func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest(`POST`, `/api/select`, nil))
+		close(done)
+	}()
+	<-started
+
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"new","Connections":[`+
+		`{"Name":"kept","Driver":"snowflake","ConnStr":"kept"},`+
+		`{"Name":"added","Driver":"snowflake","ConnStr":"added"}]}`)
+	err = s.Reload()
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if s.Settings.ApiKey != `new` {
+		t.Fatalf(`expected new api key but got %v`, s.Settings.ApiKey)
+	}
+	if s.Persistors[`kept`] != opened[`kept`] {
+		t.Fatalf(`expected unchanged connection to keep its persistor`)
+	}
+	if _, ok := s.Persistors[`added`]; !ok {
+		t.Fatalf(`expected added connection`)
+	}
+	if opened[`removed`].closed {
+		t.Fatalf(`expected removed connection to stay open while a request uses it`)
+	}
+
+	close(release)
+	if apiKey := <-seenApiKey; apiKey != `old` {
+		t.Fatalf(`expected in-flight request to keep the old settings but got %v`, apiKey)
+	}
+	<-done
+	if !opened[`removed`].closed {
+		t.Fatalf(`expected removed connection to be closed`)
+	}
+	if opened[`kept`].closed {
+		t.Fatalf(`expected kept connection to stay open`)
+	}
+}
+
+func TestReloadRejectsInvalidSettings(t *testing.T) {
+	original := openPersistor
+	openPersistor = func(conn Connection) (persistance.Persistor, error) {
+		return &closingPersistor{}, nil
+	}
+	defer func() { openPersistor = original }()
+
+	path := filepath.Join(t.TempDir(), `server.json`)
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"old","Connections":[{"Name":"test","Driver":"snowflake","ConnStr":"test"}]}`)
+	s, err := LoadServer(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"","Connections":[{"Name":"test","Driver":"oracle","ConnStr":"test"}]}`)
+	err = s.Reload()
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+	if s.Settings.ApiKey != `old` || s.Settings.Connections[0].Driver != `snowflake` {
+		t.Fatalf(`expected previous settings to be kept`)
+	}
+}
+
+func TestReloadKeepsPoolOpenForOlderGenerations(t *testing.T) {
+	opened := map[string]*closingPersistor{}
+	original := openPersistor
+	openPersistor = func(conn Connection) (persistance.Persistor, error) {
+		persistor := &closingPersistor{}
+		opened[conn.ConnStr] = persistor
+		return persistor, nil
+	}
+	defer func() { openPersistor = original }()
+
+	path := filepath.Join(t.TempDir(), `server.json`)
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"first","Connections":[{"Name":"kept","Driver":"snowflake","ConnStr":"kept"}]}`)
+	s, err := LoadServer(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	handler := s.current(func(_ *Server, _ http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+	})
+	go func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest(`POST`, `/api/export`, nil))
+		close(done)
+	}()
+	<-started
+
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"second","Connections":[{"Name":"kept","Driver":"snowflake","ConnStr":"kept"}]}`)
+	if err = s.Reload(); err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"third","Connections":[{"Name":"other","Driver":"snowflake","ConnStr":"other"}]}`)
+	if err = s.Reload(); err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if opened[`kept`].closed {
+		t.Fatalf(`expected pool to stay open while a request from an older generation uses it`)
+	}
+	close(release)
+	<-done
+	if !opened[`kept`].closed {
+		t.Fatalf(`expected pool to be closed after the last request finished`)
+	}
+}
+
+func TestReloadRefusedAfterClose(t *testing.T) {
+	original := openPersistor
+	openPersistor = func(conn Connection) (persistance.Persistor, error) {
+		return &closingPersistor{}, nil
+	}
+	defer func() { openPersistor = original }()
+
+	path := filepath.Join(t.TempDir(), `server.json`)
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"old","Connections":[{"Name":"test","Driver":"snowflake","ConnStr":"test"}]}`)
+	s, err := LoadServer(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	_ = s.Close()
+	writeReloadSettings(t, path, `{"Address":"localhost:0","ApiKey":"new","Connections":[{"Name":"test","Driver":"snowflake","ConnStr":"changed"}]}`)
+	if err = s.Reload(); err == nil {
+		t.Fatalf(`expected reload to be refused after Close`)
+	}
+	if s.Settings.ApiKey != `old` {
+		t.Fatalf(`expected settings to be unchanged but got %v`, s.Settings.ApiKey)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const secretFilePrefix = `file:`
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveSecret decrypts a value of the form enc:..., replaces a value of the
+// form file:/path with the contents of the file and replaces every ${NAME}
+// with the environment variable NAME. The master key is only loaded when an
+// encrypted value is found.
+func resolveSecret(value string, masterKey func() ([]byte, error)) (string, error) {
+	if strings.HasPrefix(value, encryptedSecretPrefix) {
+		key, err := masterKey()
+		if err != nil {
+			return ``, err
+		}
+		return decryptSecret(key, value)
+	}
+	if strings.HasPrefix(value, secretFilePrefix) {
+		path := strings.TrimPrefix(value, secretFilePrefix)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return ``, fmt.Errorf(`error reading secret file %v: %v`, path, err.Error())
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	var missing []string
+	resolved := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return envValue
+	})
+	if len(missing) > 0 {
+		return ``, fmt.Errorf(`environment variable(s) %v are not set`, strings.Join(missing, `, `))
+	}
+	return resolved, nil
+}
+
+func (s *Settings) resolveSecrets(masterKeyPath string) error {
+	type secretField struct {
+		name  string
+		value *string
+	}
+	fields := []secretField{
+		{`Address`, &s.Address},
+		{`ApiKey`, &s.ApiKey},
+		{`Audit.Path`, &s.Audit.Path},
+		{`Audit.Connection`, &s.Audit.Connection},
+		{`Audit.Table`, &s.Audit.Table},
+	}
+	for index := range s.Users {
+		fields = append(fields, secretField{fmt.Sprintf(`Users[%v].ApiKey`, index), &s.Users[index].ApiKey})
+	}
+	for index := range s.Connections {
+		fields = append(fields, secretField{fmt.Sprintf(`Connections[%v].ConnStr`, index), &s.Connections[index].ConnStr})
+	}
+	var key []byte
+	masterKey := func() ([]byte, error) {
+		if key != nil {
+			return key, nil
+		}
+		var err error
+		key, err = LoadMasterKey(masterKeyPath)
+		return key, err
+	}
+	for _, field := range fields {
+		resolved, err := resolveSecret(*field.value, masterKey)
+		if err != nil {
+			return fmt.Errorf(`%v: %v`, field.name, err.Error())
+		}
+		*field.value = resolved
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func noMasterKey() ([]byte, error) {
+	return nil, errors.New(`no master key`)
+}
+
+func TestResolveSecretEnv(t *testing.T) {
+	t.Setenv(`TABLEAU_CRUD_TEST_USER`, `tester`)
+	t.Setenv(`TABLEAU_CRUD_TEST_PASSWORD`, `secret`)
+	resolved, err := resolveSecret(`${TABLEAU_CRUD_TEST_USER}:${TABLEAU_CRUD_TEST_PASSWORD}@account/DB`, noMasterKey)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if resolved != `tester:secret@account/DB` {
+		t.Fatalf(`expected substituted value but got %v`, resolved)
+	}
+}
+
+func TestResolveSecretMissingEnv(t *testing.T) {
+	_, err := resolveSecret(`user:${TABLEAU_CRUD_TEST_MISSING}@account`, noMasterKey)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestResolveSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `api_key`)
+	_ = os.WriteFile(path, []byte("from-file\n"), 0600)
+	resolved, err := resolveSecret(`file:`+path, noMasterKey)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if resolved != `from-file` {
+		t.Fatalf(`expected file contents but got '%v'`, resolved)
+	}
+	_, err = resolveSecret(`file:`+path+`.missing`, noMasterKey)
+	if err == nil {
+		t.Fatalf(`expected error for missing file but got none`)
+	}
+}
+
+func TestLoadSettingsResolvesSecrets(t *testing.T) {
+	t.Setenv(`TABLEAU_CRUD_TEST_PASSWORD`, `secret`)
+	path := filepath.Join(t.TempDir(), `server.json`)
+	_ = os.WriteFile(path, []byte(`{"ApiKey":"12345","Connections":[{"Name":"test","Driver":"snowflake","ConnStr":"user:${TABLEAU_CRUD_TEST_PASSWORD}@account"}]}`), 0600)
+	settings, err := loadSettings(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if settings.Connections[0].ConnStr != `user:secret@account` {
+		t.Fatalf(`expected resolved ConnStr but got %v`, settings.Connections[0].ConnStr)
+	}
+}
+
+func TestLoadSettingsDecryptsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	key, err := GenerateMasterKey(MasterKeyPath(filepath.Join(dir, `server.json`)))
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	encrypted, err := EncryptSecret(key, `user:secret@account`)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	path := filepath.Join(dir, `server.json`)
+	_ = os.WriteFile(path, []byte(`{"ApiKey":"12345","Connections":[{"Name":"test","Driver":"snowflake","ConnStr":"`+encrypted+`"}]}`), 0600)
+	settings, err := loadSettings(path)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if settings.Connections[0].ConnStr != `user:secret@account` {
+		t.Fatalf(`expected decrypted ConnStr but got %v`, settings.Connections[0].ConnStr)
+	}
+}
@@ -2,17 +2,23 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"io"
+	"log"
 	"mime"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
-	errors "tableau_crud/error_messaging"
+	"sync"
+	"tableau_crud/audit"
+	"tableau_crud/history"
 	v "tableau_crud/params_validators"
 	"tableau_crud/persistance"
+	"time"
 )
 
 type Settings struct {
@@ -20,59 +26,106 @@ type Settings struct {
 	UseTls      bool
 	Connections []Connection
 	ApiKey      string
+	Users       []UserKey
+	Audit       audit.Settings
+	Timeouts    Timeouts
+	MasterKey   string
 }
 
 type Connection struct {
-	Name    string
-	Driver  string
-	ConnStr string
+	Name                    string
+	Driver                  string
+	ConnStr                 string
+	Tables                  []Table
+	CountCacheSeconds       int
+	StatementTimeoutSeconds int
+	OperationTimeouts       map[string]int
+	Pool                    Pool
+}
+
+// Pool limits the sessions a connection opens against its warehouse. See
+// persistance.Options for the meaning of zero values, Lazy and WarmUp.
+type Pool struct {
+	MaxOpenConns           int
+	MaxIdleConns           int
+	ConnMaxLifetimeSeconds int
+	ConnMaxIdleTimeSeconds int
+	Lazy                   bool
+	WarmUp                 bool
 }
 
 func loadSettings(settingsPath string) (Settings, error) {
-	settings := Settings{}
-	contentBytes, err := os.ReadFile(settingsPath)
+	settings, problems, err := readSettings(settingsPath)
 	if err != nil {
 		return settings, err
 	}
-	err = json.Unmarshal(contentBytes, &settings)
+	return settings, errors.Join(problems...)
+}
+
+// readSettings returns every problem found in the file so that they can be
+// reported together. The error is only set when the file cannot be read.
+func readSettings(settingsPath string) (Settings, []error, error) {
+	contentBytes, err := os.ReadFile(settingsPath)
+	if err != nil {
+		return Settings{}, nil, err
+	}
+	settings, problems, err := decodeSettings(settingsPath, contentBytes)
 	if err != nil {
-		return settings, err
+		return settings, nil, err
 	}
-	return settings, nil
+	err = settings.resolveSecrets(settings.masterKeyPath(settingsPath))
+	if err != nil {
+		problems = append(problems, fmt.Errorf(`%v: %w`, settingsPath, err))
+	}
+	return settings, problems, nil
 }
 
 func LoadServer(settingsPath string) (*Server, error) {
 	var err error
 	server := &Server{
-		Persistors: make(map[string]persistance.Persistor),
+		Persistors:   make(map[string]persistance.Persistor),
+		HtmlPath:     `html`,
+		settingsPath: settingsPath,
 	}
 	server.Settings, err = loadSettings(settingsPath)
 	if err != nil {
 		return nil, err
 	}
+	if problems := server.Settings.problems(); len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
 	for _, conn := range server.Settings.Connections {
-		switch {
-		case conn.Driver == `snowflake`:
-			persistor, err := persistance.NewPersistor(conn.ConnStr)
-			if err != nil {
-				return nil, err
-			}
+		persistor, err := openPersistor(conn)
+		if err != nil {
+			return nil, err
+		}
+		if persistor != nil {
 			server.Persistors[strings.ToLower(conn.Name)] = persistor
-		default:
-			fmt.Printf(`invalid driver %q, expected 'snowflake'`, conn.Driver)
 		}
 	}
+	server.Audit, err = audit.NewSink(server.Settings.Audit, server.Persistors)
+	if err != nil {
+		return nil, err
+	}
 
 	m := mux.NewRouter()
+	m.Use(withRequestId)
 	api := m.PathPrefix(`/api`).Methods(`POST`).Subrouter()
 	m.Path(`/`).Methods(`GET`).HandlerFunc(server.handleHomepage)
 	m.PathPrefix(`/`).Methods(`GET`).HandlerFunc(server.handleFile)
 
-	api.Path(`/select`).HandlerFunc(server.handleRead)
-	api.Path(`/insert`).HandlerFunc(server.handleInsert)
-	api.Path(`/update`).HandlerFunc(server.handleUpdate)
-	api.Path(`/delete`).HandlerFunc(server.handleDelete)
-	api.Path(`/test`).HandlerFunc(server.handleTestConnection)
+	api.Path(`/select`).HandlerFunc(server.current((*Server).handleRead))
+	api.Path(`/insert`).HandlerFunc(server.current((*Server).handleInsert))
+	api.Path(`/update`).HandlerFunc(server.current((*Server).handleUpdate))
+	api.Path(`/delete`).HandlerFunc(server.current((*Server).handleDelete))
+	api.Path(`/test`).HandlerFunc(server.current((*Server).handleTestConnection))
+	api.Path(`/history`).HandlerFunc(server.current((*Server).handleHistory))
+	api.Path(`/undo`).HandlerFunc(server.current((*Server).handleUndo))
+	api.Path(`/lookup`).HandlerFunc(server.current((*Server).handleLookup))
+	api.Path(`/distinct`).HandlerFunc(server.current((*Server).handleDistinct))
+	api.Path(`/aggregate`).HandlerFunc(server.current((*Server).handleAggregate))
+	api.Path(`/export`).HandlerFunc(server.current((*Server).handleExport))
+	api.Path(`/import`).HandlerFunc(server.current((*Server).handleImport))
 
 	server.Handler = m
 
@@ -83,10 +136,41 @@ type Server struct {
 	Settings   Settings
 	Handler    http.Handler
 	Persistors map[string]persistance.Persistor
+	Audit      audit.Sink
+	HtmlPath   string
+
+	settingsPath   string
+	lock           sync.RWMutex
+	reloading      sync.Mutex
+	closed         bool
+	referencesLock sync.Mutex
+	references     map[io.Closer]int
+	retired        map[io.Closer]bool
+}
+
+// openPersistor returns a nil persistor for an unsupported driver so that the
+// remaining connections can still be served.
+var openPersistor = func(conn Connection) (persistance.Persistor, error) {
+	switch {
+	case conn.Driver == `snowflake`:
+		return persistance.NewPersistor(conn.ConnStr, persistance.Options{
+			CountCacheTtl:    time.Duration(conn.CountCacheSeconds) * time.Second,
+			StatementTimeout: time.Duration(conn.StatementTimeoutSeconds) * time.Second,
+			MaxOpenConns:     conn.Pool.MaxOpenConns,
+			MaxIdleConns:     conn.Pool.MaxIdleConns,
+			ConnMaxLifetime:  time.Duration(conn.Pool.ConnMaxLifetimeSeconds) * time.Second,
+			ConnMaxIdleTime:  time.Duration(conn.Pool.ConnMaxIdleTimeSeconds) * time.Second,
+			Lazy:             conn.Pool.Lazy,
+			WarmUp:           conn.Pool.WarmUp,
+		})
+	default:
+		fmt.Printf(`invalid driver %q, expected 'snowflake'`, conn.Driver)
+		return nil, nil
+	}
 }
 
 func (s *Server) handleHomepage(w http.ResponseWriter, _ *http.Request) {
-	fullPath := path.Join(`html`, `index.html`)
+	fullPath := path.Join(s.HtmlPath, `index.html`)
 	content, err := os.ReadFile(fullPath)
 	if err != nil {
 		s.handle404(w)
@@ -97,7 +181,7 @@ func (s *Server) handleHomepage(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
-	fullPath := path.Join(`html`, r.URL.Path)
+	fullPath := path.Join(s.HtmlPath, r.URL.Path)
 	content, err := os.ReadFile(fullPath)
 	if err != nil {
 		s.handle404(w)
@@ -109,7 +193,7 @@ func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handle404(w http.ResponseWriter) {
-	err404, _ := os.ReadFile(path.Join(`html`, `404.html`))
+	err404, _ := os.ReadFile(path.Join(s.HtmlPath, `404.html`))
 	w.WriteHeader(404)
 	_, _ = w.Write(err404)
 }
@@ -117,94 +201,311 @@ func (s *Server) handle404(w http.ResponseWriter) {
 func (s *Server) handleInsert(w http.ResponseWriter, r *http.Request) {
 	params, err := validatePayload[InsertParams](s, r)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 	persistor, err := s.getPersistor(params.Connection)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
-	result, err := persistor.Insert(params.Table, params.Values)
+	ctx, cancel := s.operationContext(r, params.Connection, `insert`)
+	defer cancel()
+	table := s.getTable(params.Connection, params.Table)
+	values, err := table.applyDefaults(params.Values)
 	if err != nil {
-		sendErrorResponse(w, errors.GenerateErrorMessage(`error inserting records`, err))
+		sendErrorResponse(w, badRequest(`invalid_values`, err))
 		return
 	}
+	err = table.validate(ctx, persistor, values, true)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	values, err = table.ManagedColumns.ApplyToInsert(values, params.User, time.Now())
+	if err != nil {
+		sendErrorResponse(w, badRequest(`invalid_values`, err))
+		return
+	}
+	var result int64
+	if recorder := table.recorder(params.User); recorder != nil {
+		result, err = recorder.Insert(ctx, persistor, values)
+	} else {
+		result, err = persistor.Insert(ctx, params.Table, values)
+	}
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error inserting records`, err))
+		return
+	}
+	s.recordAudit(r, params.User, audit.Entry{
+		Connection:   params.Connection,
+		Table:        params.Table,
+		Operation:    `insert`,
+		Values:       values,
+		RowsAffected: result,
+	})
 	sendNormalResponse(w, result)
 }
 
 func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	params, err := validatePayload[UpdateParams](s, r)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 	persistor, err := s.getPersistor(params.Connection)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
+	ctx, cancel := s.operationContext(r, params.Connection, `update`)
+	defer cancel()
 	whereClauses, err := v.ValidateWhereClauses(params.Where)
 	if err != nil {
-		sendErrorResponse(w, fmt.Sprintf(`error decoding where clauses: %v`, err.Error()))
+		sendErrorResponse(w, invalidField(`Where`, `error decoding where clauses`, err))
 		return
 	}
 	updateClauses, err := v.ValidateUpdateClauses(params.Updates)
 	if err != nil {
-		sendErrorResponse(w, fmt.Sprintf(`error decoding update clauses: %v`, err.Error()))
+		sendErrorResponse(w, invalidField(`Updates`, `error decoding update clauses`, err))
+		return
+	}
+	table := s.getTable(params.Connection, params.Table)
+	err = table.checkUpdatable(params.Updates)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	err = table.validate(ctx, persistor, params.Updates, false)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	if table.IsSoftDelete() {
+		whereClauses = append(whereClauses, table.notDeletedClause())
+	}
+	err = table.validateUpdatedRows(ctx, persistor, whereClauses, params.Updates)
+	if err != nil {
+		sendErrorResponse(w, err)
 		return
 	}
-	result, err := persistor.Update(params.Table, whereClauses, updateClauses)
+	updateClauses, err = table.ManagedColumns.ApplyToUpdate(updateClauses, params.User, time.Now())
 	if err != nil {
-		sendErrorResponse(w, errors.GenerateErrorMessage(`error updating records`, err))
+		sendErrorResponse(w, badRequest(`invalid_values`, err))
 		return
 	}
+	var result int64
+	if recorder := table.recorder(params.User); recorder != nil {
+		result, err = recorder.Update(ctx, persistor, whereClauses, updateClauses)
+	} else {
+		result, err = persistor.Update(ctx, params.Table, whereClauses, updateClauses)
+	}
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error updating records`, err))
+		return
+	}
+	s.recordAudit(r, params.User, audit.Entry{
+		Connection:   params.Connection,
+		Table:        params.Table,
+		Operation:    `update`,
+		Where:        params.Where,
+		Values:       updateValues(updateClauses),
+		RowsAffected: result,
+	})
 	sendNormalResponse(w, result)
 }
 
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 	params, err := validatePayload[DeleteParams](s, r)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 	persistor, err := s.getPersistor(params.Connection)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
+	ctx, cancel := s.operationContext(r, params.Connection, `delete`)
+	defer cancel()
 	whereClauses, err := v.ValidateWhereClauses(params.Where)
 	if err != nil {
-		sendErrorResponse(w, fmt.Sprintf(`error decoding where clauses: %v`, err.Error()))
+		sendErrorResponse(w, invalidField(`Where`, `error decoding where clauses`, err))
 		return
 	}
-	result, err := persistor.Delete(params.Table, whereClauses)
+	table := s.getTable(params.Connection, params.Table)
+	recorder := table.recorder(params.User)
+	var result int64
+	switch {
+	case table.IsSoftDelete():
+		whereClauses = append(whereClauses, table.notDeletedClause())
+		updates := table.softDeleteUpdates(params.User, time.Now())
+		if recorder != nil {
+			result, err = recorder.Update(ctx, persistor, whereClauses, updates)
+		} else {
+			result, err = persistor.Update(ctx, params.Table, whereClauses, updates)
+		}
+	case recorder != nil:
+		result, err = recorder.Delete(ctx, persistor, whereClauses)
+	default:
+		result, err = persistor.Delete(ctx, params.Table, whereClauses)
+	}
 	if err != nil {
-		sendErrorResponse(w, errors.GenerateErrorMessage(`error deleting records`, err))
+		sendErrorResponse(w, databaseError(`error deleting records`, err))
 		return
 	}
+	s.recordAudit(r, params.User, audit.Entry{
+		Connection:   params.Connection,
+		Table:        params.Table,
+		Operation:    `delete`,
+		Where:        params.Where,
+		RowsAffected: result,
+	})
 	sendNormalResponse(w, result)
 }
 
 func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
 	params, err := validatePayload[ReadParams](s, r)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
 	persistor, err := s.getPersistor(params.Connection)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
 		return
 	}
+	ctx, cancel := s.operationContext(r, params.Connection, `select`)
+	defer cancel()
 	whereClauses, err := v.ValidateWhereClauses(params.Where)
 	if err != nil {
-		sendErrorResponse(w, fmt.Sprintf(`error decoding where clauses: %v`, err.Error()))
+		sendErrorResponse(w, invalidField(`Where`, `error decoding where clauses`, err))
 		return
 	}
-	data, err := persistor.Read(params.Table, params.Fields, whereClauses, params.OrderBy, params.PageSize, params.Page)
+	if table := s.getTable(params.Connection, params.Table); table.IsSoftDelete() && !params.IncludeDeleted {
+		whereClauses = append(whereClauses, table.notDeletedClause())
+	}
+	format, err := responseFormat(r, params.Format)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	keyset := params.PageToken != `` || params.Keyset
+	err = checkPaging(params.PageSize, params.Page, keyset)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	fields, orderBy := params.Fields, params.OrderBy
+	if keyset {
+		fields, orderBy, err = s.getTable(params.Connection, params.Table).keysetOrder(fields, orderBy)
+		if err != nil {
+			sendErrorResponse(w, err)
+			return
+		}
+	}
+	data, err := persistor.Read(ctx, persistance.ReadQuery{
+		Table:            params.Table,
+		Fields:           fields,
+		Where:            whereClauses,
+		OrderBy:          orderBy,
+		PageSize:         params.PageSize,
+		Page:             params.Page,
+		Keyset:           keyset,
+		PageToken:        params.PageToken,
+		IncludeTotal:     params.IncludeTotal,
+		ApproximateTotal: params.ApproximateTotal,
+	})
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error reading records`, err))
+		return
+	}
+	sendNormalResponse(w, &formattedResult{Result: data, Format: format})
+}
+
+func (s *Server) handleDistinct(w http.ResponseWriter, r *http.Request) {
+	params, err := validatePayload[DistinctParams](s, r)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	persistor, err := s.getPersistor(params.Connection)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `distinct`)
+	defer cancel()
+	whereClauses, err := v.ValidateWhereClauses(params.Where)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, invalidField(`Where`, `error decoding where clauses`, err))
+		return
+	}
+	if table := s.getTable(params.Connection, params.Table); table.IsSoftDelete() && !params.IncludeDeleted {
+		whereClauses = append(whereClauses, table.notDeletedClause())
+	}
+	if params.Search != `` {
+		whereClauses = append(whereClauses, &persistance.SearchClause{Identifiers: []string{params.Column}, Text: params.Search})
+	}
+	if params.Limit <= 0 || params.Limit > maxDistinctLimit {
+		params.Limit = maxDistinctLimit
+	}
+	data, err := persistor.Distinct(ctx, persistance.DistinctQuery{
+		Table:         params.Table,
+		Column:        params.Column,
+		Where:         whereClauses,
+		IncludeCounts: params.IncludeCounts,
+		OrderBy:       params.OrderBy,
+		Descending:    params.Descending,
+		Limit:         params.Limit,
+	})
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error reading distinct values`, err))
+		return
+	}
+	sendNormalResponse(w, data)
+}
+
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	params, err := validatePayload[AggregateParams](s, r)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	persistor, err := s.getPersistor(params.Connection)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `aggregate`)
+	defer cancel()
+	whereClauses, err := v.ValidateWhereClauses(params.Where)
+	if err != nil {
+		sendErrorResponse(w, invalidField(`Where`, `error decoding where clauses`, err))
+		return
+	}
+	havingClauses, err := v.ValidateWhereClauses(params.Having)
+	if err != nil {
+		sendErrorResponse(w, invalidField(`Having`, `error decoding having clauses`, err))
+		return
+	}
+	if table := s.getTable(params.Connection, params.Table); table.IsSoftDelete() && !params.IncludeDeleted {
+		whereClauses = append(whereClauses, table.notDeletedClause())
+	}
+	if params.Limit <= 0 || params.Limit > maxAggregateLimit {
+		params.Limit = maxAggregateLimit
+	}
+	data, err := persistor.Aggregate(ctx, persistance.AggregateQuery{
+		Table:        params.Table,
+		GroupBy:      params.GroupBy,
+		Aggregations: params.Aggregations,
+		Where:        whereClauses,
+		Having:       havingClauses,
+		OrderBy:      params.OrderBy,
+		Limit:        params.Limit,
+	})
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error aggregating records`, err))
 		return
 	}
 	sendNormalResponse(w, data)
@@ -213,90 +514,257 @@ func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleTestConnection(w http.ResponseWriter, r *http.Request) {
 	params, err := validatePayload[TestParams](s, r)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
+		return
+	}
+	persistor, err := s.getPersistor(params.Connection)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `test`)
+	defer cancel()
+	result, err := persistor.TestConnection(ctx, params.Table)
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error testing connection`, err))
+		return
+	}
+	sendNormalResponse(w, result)
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	params, err := validatePayload[HistoryParams](s, r)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	persistor, err := s.getPersistor(params.Connection)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `history`)
+	defer cancel()
+	table := s.getTable(params.Connection, params.Table)
+	if table.HistoryTable == `` {
+		sendErrorResponse(w, notFound(`history_not_found`, `table %q does not record history`, params.Table))
+		return
+	}
+	err = checkPaging(params.PageSize, params.Page, false)
+	if err != nil {
+		sendErrorResponse(w, err)
+		return
+	}
+	data, err := history.Read(ctx, persistor, table.HistoryTable, table.KeyFields, params.Key, params.PageSize, params.Page)
+	if err != nil {
+		sendErrorResponse(w, databaseError(`error reading history`, err))
+		return
+	}
+	sendNormalResponse(w, data)
+}
+
+func (s *Server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	params, err := validatePayload[UndoParams](s, r)
+	if err != nil {
+		sendErrorResponse(w, err)
 		return
 	}
 	persistor, err := s.getPersistor(params.Connection)
 	if err != nil {
-		sendErrorResponse(w, err.Error())
+		sendErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := s.operationContext(r, params.Connection, `undo`)
+	defer cancel()
+	recorder := s.getTable(params.Connection, params.Table).recorder(params.User)
+	if recorder == nil {
+		sendErrorResponse(w, notFound(`history_not_found`, `table %q does not record history`, params.Table))
 		return
 	}
-	result, err := persistor.TestConnection(params.Table)
+	var result int64
+	if params.ChangeId != `` {
+		result, err = recorder.Undo(ctx, persistor, params.ChangeId)
+	} else {
+		result, err = recorder.UndoLast(ctx, persistor, params.Last)
+	}
 	if err != nil {
-		sendErrorResponse(w, errors.GenerateErrorMessage(`error testing connection`, err))
+		sendErrorResponse(w, databaseError(`error undoing changes`, err))
 		return
 	}
+	s.recordAudit(r, params.User, audit.Entry{
+		Connection:   params.Connection,
+		Table:        params.Table,
+		Operation:    `undo`,
+		Values:       map[string]interface{}{`ChangeId`: params.ChangeId, `Last`: params.Last},
+		RowsAffected: result,
+	})
 	sendNormalResponse(w, result)
 }
 
-func (s *Server) checkApiKey(apiKey string) error {
-	if apiKey == s.Settings.ApiKey {
-		return nil
+// checkApiKey returns the caller's identity derived from the API key.
+func (s *Server) checkApiKey(apiKey string) (string, error) {
+	if user, ok := s.Settings.authenticate(apiKey); ok {
+		return user, nil
+	}
+	if apiKey == `` {
+		return ``, newApiError(http.StatusUnauthorized, `missing_api_key`, `api key is required`)
+	}
+	return ``, newApiError(http.StatusForbidden, `invalid_api_key`, `api key is invalid`)
+}
+
+// updateValues lists the values an update applied, including the managed
+// columns set by the server, for the audit log.
+func updateValues(updates []persistance.SqlSnippetGenerator) map[string]interface{} {
+	values := make(map[string]interface{}, len(updates))
+	for _, generator := range updates {
+		if update, ok := generator.(*persistance.UpdateClause); ok {
+			values[update.Identifier] = update.NewValue
+		}
+	}
+	return values
+}
+
+// recordAudit takes the user authenticated by checkApiKey so that the audit
+// log never records a name chosen by the client.
+func (s *Server) recordAudit(r *http.Request, user string, entry audit.Entry) {
+	if s.Audit == nil {
+		return
+	}
+	entry.Timestamp = time.Now()
+	entry.User = user
+	entry.RemoteAddr = r.RemoteAddr
+	err := s.Audit.Write(entry)
+	if err != nil {
+		log.Printf(`error writing audit entry for %v on %v.%v: %v`, entry.Operation, entry.Connection, entry.Table, err.Error())
 	}
-	return fmt.Errorf(`api key is invalid`)
 }
 
 func (s *Server) getPersistor(connection string) (persistance.Persistor, error) {
 	persistor, ok := s.Persistors[strings.ToLower(connection)]
 	if !ok {
-		return nil, fmt.Errorf(`connection %q is not valid`, connection)
+		return nil, notFound(`connection_not_found`, `connection %q is not valid`, connection)
 	}
 	return persistor, nil
 }
 
-func validatePayload[T ApiKeyPayload](s *Server, r *http.Request) (T, error) {
+func validatePayload[T any, P authenticatedPayload[T]](s *Server, r *http.Request) (T, error) {
 	var params T
 	j := json.NewDecoder(r.Body)
 	err := j.Decode(&params)
 	if err != nil {
-		return params, err
+		return params, newApiError(http.StatusBadRequest, `invalid_payload`, fmt.Sprintf(`error decoding request: %v`, err.Error()))
 	}
-	err = s.checkApiKey(params.GetApiKey())
+	err = s.authenticatePayload(P(&params))
 	return params, err
 }
 
+func (s *Server) authenticatePayload(params ApiKeyPayload) error {
+	user, err := s.checkApiKey(params.GetApiKey())
+	if err != nil {
+		return err
+	}
+	params.setUser(user)
+	return nil
+}
+
 func setHeaders(w http.ResponseWriter, contentType string) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id, X-Total-Row-Count, X-Next-Page-Token")
 	w.Header().Set("Content-Type", contentType)
 }
 
 func sendNormalResponse(w http.ResponseWriter, data interface{}) {
+	var responseBytes []byte
+	var marshalErr error
+	if formatted, ok := data.(*formattedResult); ok {
+		if formatted.Format == `arrow` {
+			sendArrowResponse(w, formatted.Result)
+			return
+		}
+		responseBytes, marshalErr = formatted.marshal()
+	} else {
+		responseBytes, marshalErr = json.Marshal(data)
+	}
 	setHeaders(w, "application/json")
-	responseBytes, marshalErr := json.Marshal(data)
 	if marshalErr != nil {
-		sendErrorResponse(w, marshalErr.Error())
+		sendErrorResponse(w, marshalErr)
 		return
 	}
 	_, _ = w.Write(responseBytes)
 }
 
-func sendErrorResponse(w http.ResponseWriter, err string) {
-	w.WriteHeader(500)
-	_, _ = w.Write([]byte(err))
-}
-
 type ApiKeyPayload interface {
 	GetApiKey() string
+	setUser(user string)
+}
+
+type authenticatedPayload[T any] interface {
+	*T
+	ApiKeyPayload
 }
 
+// ApiKey is embedded in every payload. User is set by the server from the
+// API key; a User sent by the client is ignored.
 type ApiKey struct {
 	ApiKey string
+	User   string `json:"-"`
 }
 
 func (a ApiKey) GetApiKey() string {
 	return a.ApiKey
 }
 
+func (a *ApiKey) setUser(user string) {
+	a.User = user
+}
+
 type ReadParams struct {
 	ApiKey
-	Connection string
-	Table      string
-	Fields     []string
-	Where      []interface{}
-	OrderBy    []string
-	PageSize   int
-	Page       int
+	Connection       string
+	Table            string
+	Fields           []string
+	Where            []interface{}
+	OrderBy          []string
+	PageSize         int
+	Page             int
+	IncludeDeleted   bool
+	Keyset           bool
+	PageToken        string
+	IncludeTotal     bool
+	ApproximateTotal bool
+	Format           string
+}
+
+const maxDistinctLimit = 10000
+
+type DistinctParams struct {
+	ApiKey
+	Connection     string
+	Table          string
+	Column         string
+	Where          []interface{}
+	Search         string
+	IncludeCounts  bool
+	OrderBy        string
+	Descending     bool
+	Limit          int
+	IncludeDeleted bool
+}
+
+const maxAggregateLimit = 10000
+
+type AggregateParams struct {
+	ApiKey
+	Connection     string
+	Table          string
+	GroupBy        []string
+	Aggregations   []persistance.Aggregation
+	Where          []interface{}
+	Having         []interface{}
+	OrderBy        []string
+	Limit          int
+	IncludeDeleted bool
 }
 
 type UpdateParams struct {
@@ -326,3 +794,20 @@ type InsertParams struct {
 	Table      string
 	Values     map[string]interface{}
 }
+
+type HistoryParams struct {
+	ApiKey
+	Connection string
+	Table      string
+	Key        map[string]interface{}
+	PageSize   int
+	Page       int
+}
+
+type UndoParams struct {
+	ApiKey
+	Connection string
+	Table      string
+	ChangeId   string
+	Last       int
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// decodeSettings parses a JSON, YAML or TOML settings file, chosen by its
+// extension, and checks every key against Settings. Unknown keys and values
+// of the wrong type are returned as problems with their location and left
+// out, so that the remaining settings can still be checked. The error is only
+// set when the file cannot be parsed at all.
+func decodeSettings(settingsPath string, content []byte) (Settings, []error, error) {
+	settings := Settings{}
+	var document interface{}
+	var err error
+	switch strings.ToLower(filepath.Ext(settingsPath)) {
+	case `.yaml`, `.yml`:
+		err = yaml.Unmarshal(content, &document)
+	case `.toml`:
+		tables := map[string]interface{}{}
+		_, err = toml.Decode(string(content), &tables)
+		document = normalizeTomlValue(tables)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&document)
+	}
+	if err != nil {
+		return settings, nil, fmt.Errorf(`%v: %v`, settingsPath, err.Error())
+	}
+	if document == nil {
+		document = map[string]interface{}{}
+	}
+
+	problems := make([]error, 0)
+	document = checkSettingsValue(document, reflect.TypeOf(settings), ``, func(location string, message string) {
+		problems = append(problems, fmt.Errorf(`%v: %v: %v`, settingsPath, location, message))
+	})
+	checked, err := json.Marshal(document)
+	if err == nil {
+		err = json.Unmarshal(checked, &settings)
+	}
+	if err != nil {
+		return settings, nil, fmt.Errorf(`%v: %v`, settingsPath, err.Error())
+	}
+	return settings, problems, nil
+}
+
+// checkSettingsValue returns value with every invalid entry removed, or nil
+// if value itself does not match target.
+func checkSettingsValue(value interface{}, target reflect.Type, location string, report func(location string, message string)) interface{} {
+	if value == nil {
+		return nil
+	}
+	mismatch := func(expected string) interface{} {
+		report(locationOrRoot(location), fmt.Sprintf(`expected %v but got %v`, expected, describeSettingsValue(value)))
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.Ptr:
+		return checkSettingsValue(value, target.Elem(), location, report)
+	case reflect.Struct:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch(`an object`)
+		}
+		for _, key := range sortedKeys(fields) {
+			fieldLocation := joinLocation(location, key)
+			field, found := target.FieldByName(key)
+			if !found || !field.IsExported() {
+				report(fieldLocation, unknownFieldMessage(target, key))
+				delete(fields, key)
+				continue
+			}
+			fields[key] = checkSettingsValue(fields[key], field.Type, fieldLocation, report)
+		}
+		return fields
+	case reflect.Map:
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch(`an object`)
+		}
+		for _, key := range sortedKeys(entries) {
+			entries[key] = checkSettingsValue(entries[key], target.Elem(), joinLocation(location, key), report)
+		}
+		return entries
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch(`a list`)
+		}
+		for index := range items {
+			items[index] = checkSettingsValue(items[index], target.Elem(), fmt.Sprintf(`%v[%v]`, location, index), report)
+		}
+		return items
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return mismatch(`a string`)
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return mismatch(`true or false`)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, ok := settingsNumber(value)
+		if !ok || number != math.Trunc(number) {
+			return mismatch(`a whole number`)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := settingsNumber(value); !ok {
+			return mismatch(`a number`)
+		}
+	}
+	return value
+}
+
+// normalizeTomlValue turns arrays of tables, which the toml package decodes
+// as []map[string]interface{}, into the []interface{} used by the other
+// formats.
+func normalizeTomlValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, entry := range typed {
+			typed[key] = normalizeTomlValue(entry)
+		}
+		return typed
+	case []map[string]interface{}:
+		items := make([]interface{}, len(typed))
+		for index, entry := range typed {
+			items[index] = normalizeTomlValue(entry)
+		}
+		return items
+	case []interface{}:
+		for index, entry := range typed {
+			typed[index] = normalizeTomlValue(entry)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+func settingsNumber(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case json.Number:
+		parsed, err := number.Float64()
+		return parsed, err == nil
+	case int:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case uint64:
+		return float64(number), true
+	case float64:
+		return number, true
+	default:
+		return 0, false
+	}
+}
+
+func unknownFieldMessage(target reflect.Type, key string) string {
+	for index := 0; index < target.NumField(); index++ {
+		field := target.Field(index)
+		if field.IsExported() && strings.EqualFold(field.Name, key) {
+			return fmt.Sprintf(`unknown field %q, did you mean %q?`, key, field.Name)
+		}
+	}
+	return fmt.Sprintf(`unknown field %q`, key)
+}
+
+func describeSettingsValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return `an object`
+	case []interface{}:
+		return `a list`
+	case string:
+		return fmt.Sprintf(`string %q`, value)
+	default:
+		return fmt.Sprintf(`%v`, value)
+	}
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinLocation(location string, key string) string {
+	if location == `` {
+		return key
+	}
+	return location + `.` + key
+}
+
+func locationOrRoot(location string) string {
+	if location == `` {
+		return `settings`
+	}
+	return location
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSettingsFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	return path
+}
+
+func TestDecodeSettingsRejectsUnknownFields(t *testing.T) {
+	content := `{"Address":"localhost:0","useTLS":true,"ApiKey":"12345","Connections":[{"Name":"test","Driver":"snowflake","ConnStr":"x","CountCacheSeconds":"60","Tabels":[]}]}`
+	settings, problems, err := decodeSettings(`server.json`, []byte(content))
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	expected := []string{
+		`server.json: Connections[0].CountCacheSeconds: expected a whole number but got string "60"`,
+		`server.json: Connections[0].Tabels: unknown field "Tabels"`,
+		`server.json: useTLS: unknown field "useTLS", did you mean "UseTls"?`,
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf(`expected %v problems but got %v`, len(expected), problems)
+	}
+	for index, problem := range problems {
+		if problem.Error() != expected[index] {
+			t.Fatalf(`expected '%v' but got '%v'`, expected[index], problem.Error())
+		}
+	}
+	if settings.ApiKey != `12345` || settings.Connections[0].ConnStr != `x` {
+		t.Fatalf(`expected valid fields to be decoded but got %+v`, settings)
+	}
+}
+
+func TestDecodeSettingsYaml(t *testing.T) {
+	content := `
+Address: localhost:0
+UseTls: true
+ApiKey: "12345"
+Connections:
+  - Name: test
+    Driver: snowflake
+    ConnStr: x
+    StatementTimeoutSeconds: 30
+    OperationTimeouts:
+      export: 600
+`
+	settings, problems, err := decodeSettings(`server.yaml`, []byte(content))
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(problems) != 0 {
+		t.Fatalf(`expected no problems but got %v`, problems)
+	}
+	if !settings.UseTls || settings.Connections[0].StatementTimeoutSeconds != 30 || settings.Connections[0].OperationTimeouts[`export`] != 600 {
+		t.Fatalf(`unexpected settings %+v`, settings)
+	}
+}
+
+func TestDecodeSettingsToml(t *testing.T) {
+	content := `
+Address = "localhost:0"
+ApiKey = "12345"
+
+[[Connections]]
+Name = "test"
+Driver = "snowflake"
+ConnStr = "x"
+UseTls = true
+
+[[Connections.Tables]]
+Name = "orders"
+KeyFields = ["ID"]
+`
+	settings, problems, err := decodeSettings(`server.toml`, []byte(content))
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if len(problems) != 1 || problems[0].Error() != `server.toml: Connections[0].UseTls: unknown field "UseTls"` {
+		t.Fatalf(`expected unknown field problem but got %v`, problems)
+	}
+	if settings.Connections[0].Tables[0].KeyFields[0] != `ID` {
+		t.Fatalf(`unexpected settings %+v`, settings)
+	}
+}
+
+func TestCheckSettingsReportsAllProblems(t *testing.T) {
+	path := writeSettingsFile(t, `server.yaml`, `
+Address: localhost
+ApiKey: "12345"
+useTls: true
+Connections:
+  - Name: test
+    Driver: snowflake
+    ConnStr: x
+    CountCacheSeconds: -1
+    OperationTimeouts:
+      selct: 10
+`)
+	problems := CheckSettings(path)
+	messages := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		messages = append(messages, problem.Error())
+	}
+	joined := strings.Join(messages, "\n")
+	for _, expected := range []string{`useTls: unknown field`, `Address "localhost" must be host:port`, `CountCacheSeconds must not be negative`, `unknown operation "selct"`} {
+		if !strings.Contains(joined, expected) {
+			t.Fatalf("expected a problem containing '%v' but got:\n%v", expected, joined)
+		}
+	}
+}
+
+func TestLoadSettingsRejectsUnparseableFile(t *testing.T) {
+	path := writeSettingsFile(t, `server.json`, `{"Address":`)
+	_, err := loadSettings(path)
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestDecodeSettingsChecksPointerFields(t *testing.T) {
+	content := `{"Connections":[{"Name":"test","Tables":[{"Name":"T","Columns":{"CODE":{"Min":"abc","Max":5,"Lookup":{"Table":"L","Column":"C","LabelColum":"X"}}}}]}]}`
+	settings, problems, err := decodeSettings(`server.json`, []byte(content))
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	expected := []string{
+		`server.json: Connections[0].Tables[0].Columns.CODE.Lookup.LabelColum: unknown field "LabelColum"`,
+		`server.json: Connections[0].Tables[0].Columns.CODE.Min: expected a number but got string "abc"`,
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf(`expected %v problems but got %v`, len(expected), problems)
+	}
+	for index, problem := range problems {
+		if problem.Error() != expected[index] {
+			t.Fatalf(`expected '%v' but got '%v'`, expected[index], problem.Error())
+		}
+	}
+	rule := settings.Connections[0].Tables[0].Columns[`CODE`]
+	if rule.Max == nil || *rule.Max != 5 || rule.Lookup.Table != `L` {
+		t.Fatalf(`expected valid pointer fields to be decoded but got %+v`, rule)
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"tableau_crud/history"
+	v "tableau_crud/params_validators"
+	p "tableau_crud/persistance"
+	"time"
+)
+
+type Table struct {
+	Name           string
+	KeyFields      []string
+	HistoryTable   string
+	SoftDelete     SoftDelete
+	ManagedColumns v.ManagedColumns
+	Columns        map[string]v.ColumnRule
+	Rules          []v.ExpressionRule
+	Defaults       map[string]string
+	defaults       v.CompiledDefaults
+}
+
+type SoftDelete struct {
+	Column    string
+	Type      string
+	DeletedBy string
+}
+
+func validateTables(connection Connection) error {
+	for index := range connection.Tables {
+		table := &connection.Tables[index]
+		switch table.SoftDelete.Type {
+		case ``, `flag`, `timestamp`:
+		default:
+			return fmt.Errorf(`invalid soft delete type %q for table %q, expected 'flag' or 'timestamp'`, table.SoftDelete.Type, table.Name)
+		}
+		err := v.CheckColumnRules(table.Columns)
+		if err != nil {
+			return fmt.Errorf(`invalid column rules for table %q: %v`, table.Name, err.Error())
+		}
+		err = v.CheckExpressions(table.Rules)
+		if err != nil {
+			return fmt.Errorf(`invalid rules for table %q: %v`, table.Name, err.Error())
+		}
+		table.defaults, err = v.CompileDefaults(table.Defaults)
+		if err != nil {
+			return fmt.Errorf(`invalid rules for table %q: %v`, table.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// applyDefaults uses the defaults compiled by validateTables and compiles
+// them itself for tables that were not validated.
+func (t Table) applyDefaults(values map[string]interface{}) (map[string]interface{}, error) {
+	if t.defaults == nil {
+		return v.ApplyDefaults(t.Defaults, values)
+	}
+	return t.defaults.Apply(values)
+}
+
+func (t Table) IsSoftDelete() bool {
+	return t.SoftDelete.Column != ``
+}
+
+func (t Table) softDeleteUpdates(user string, now time.Time) []p.SqlSnippetGenerator {
+	var deleted interface{} = true
+	if t.SoftDelete.Type == `timestamp` {
+		deleted = now.UTC().Format(time.RFC3339Nano)
+	}
+	updates := []p.SqlSnippetGenerator{&p.UpdateClause{Identifier: t.SoftDelete.Column, NewValue: deleted}}
+	if t.SoftDelete.DeletedBy != `` {
+		updates = append(updates, &p.UpdateClause{Identifier: t.SoftDelete.DeletedBy, NewValue: user})
+	}
+	return append(updates, t.ManagedColumns.Updates(user, now)...)
+}
+
+// checkUpdatable rejects updates to the soft delete columns so that clients
+// cannot un-delete rows. Managed columns are handled by ApplyToUpdate.
+func (t Table) checkUpdatable(updates map[string]interface{}) error {
+	fieldErrors := make([]v.FieldError, 0)
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if t.IsSoftDelete() && (field == t.SoftDelete.Column || field == t.SoftDelete.DeletedBy) {
+			fieldErrors = append(fieldErrors, v.FieldError{Field: field, Rule: `soft_delete`, Message: `is maintained by soft delete and cannot be updated`})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return &v.ValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+func (t Table) notDeletedClause() p.SqlSnippetGenerator {
+	return &p.NotDeletedClause{Identifier: t.SoftDelete.Column, IsFlag: t.SoftDelete.Type != `timestamp`}
+}
+
+func (t Table) deletedClause() p.SqlSnippetGenerator {
+	return &p.NotDeletedClause{Identifier: t.SoftDelete.Column, IsFlag: t.SoftDelete.Type != `timestamp`, Exclude: true}
+}
+
+func (s *Server) getTable(connection string, table string) Table {
+	for _, conn := range s.Settings.Connections {
+		if !strings.EqualFold(conn.Name, connection) {
+			continue
+		}
+		for _, tableSettings := range conn.Tables {
+			if strings.EqualFold(tableSettings.Name, table) {
+				tableSettings.Name = table
+				return tableSettings
+			}
+		}
+	}
+	return Table{Name: table}
+}
+
+func (t Table) recorder(user string) *history.Recorder {
+	if t.HistoryTable == `` {
+		return nil
+	}
+	recorder := &history.Recorder{
+		Table:        t.Name,
+		HistoryTable: t.HistoryTable,
+		KeyFields:    t.KeyFields,
+		User:         user,
+	}
+	if t.IsSoftDelete() {
+		recorder.SoftDeleteUpdates = t.softDeleteUpdates(user, time.Now())
+	}
+	return recorder
+}
+
+func (t Table) validate(ctx context.Context, persistor p.Persistor, values map[string]interface{}, isInsert bool) error {
+	checkLookup, err := t.batchLookupChecker(ctx, persistor, []map[string]interface{}{values})
+	if err != nil {
+		return err
+	}
+	return t.validateWith(values, isInsert, checkLookup)
+}
+
+func (t Table) validateWith(values map[string]interface{}, isInsert bool, checkLookup v.LookupChecker) error {
+	return v.MergeValidationErrors(
+		v.ValidateColumns(t.Columns, values, isInsert, checkLookup),
+		v.ValidateExpressions(t.Rules, values, isInsert),
+	)
+}
+
+// validateUpdatedRows checks the rules that an update sets only some fields
+// of against the rows being updated, so that a rule such as
+// !isSet(CLOSED) || isSet(RESOLUTION) allows RESOLUTION to be updated alone.
+func (t Table) validateUpdatedRows(ctx context.Context, persistor p.Persistor, where []p.SqlSnippetGenerator, updates map[string]interface{}) error {
+	fields, err := v.PartialRuleFields(t.Rules, updates)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	tx, err := persistor.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	current, err := tx.Query(p.SelectQuery{Table: t.Name, Fields: fields, Where: where, Distinct: true})
+	if err != nil {
+		return err
+	}
+	return v.ValidateUpdatedRows(t.Rules, updates, current.Rows())
+}
+
+// batchLookupChecker reads which of the values in rows exist in each
+// table-backed lookup with one query per column, so that validating a chunk
+// of rows does not query once per row. Values are compared as the lookup
+// column's type, so the text "20240101" matches the number 20240101.
+func (t Table) batchLookupChecker(ctx context.Context, persistor p.Persistor, rows []map[string]interface{}) (v.LookupChecker, error) {
+	found := make(map[*v.Lookup]*p.RowIndex)
+	for field, rule := range t.Columns {
+		lookup := rule.Lookup
+		if lookup == nil || lookup.IsStatic() {
+			continue
+		}
+		values := make([]interface{}, 0, len(rows))
+		seen := make(map[string]bool, len(rows))
+		for _, row := range rows {
+			value := row[field]
+			text := p.KeyString([]string{field}, row)
+			if value == nil || seen[text] {
+				continue
+			}
+			seen[text] = true
+			values = append(values, value)
+		}
+		found[lookup] = p.NewRowIndex([]string{lookup.Column}, nil)
+		if len(values) == 0 {
+			continue
+		}
+		where := []p.SqlSnippetGenerator{&p.InClause{Identifier: lookup.Column, Values: values}}
+		result, err := persistor.Distinct(ctx, p.DistinctQuery{Table: lookup.Table, Column: lookup.Column, Where: where, Limit: len(values)})
+		if err != nil {
+			return nil, err
+		}
+		existing := make([]map[string]interface{}, 0, result.RowCount)
+		for _, row := range result.RowValues() {
+			existing = append(existing, map[string]interface{}{lookup.Column: row[0]})
+		}
+		found[lookup] = p.NewRowIndex([]string{lookup.Column}, existing)
+	}
+	return func(lookup *v.Lookup, value interface{}) (bool, error) {
+		index, ok := found[lookup]
+		if !ok {
+			return false, fmt.Errorf(`lookup values for %v.%v were not read`, lookup.Table, lookup.Column)
+		}
+		_, ok = index.Get(map[string]interface{}{lookup.Column: value})
+		return ok, nil
+	}, nil
+}
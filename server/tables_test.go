@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	v "tableau_crud/params_validators"
+	p "tableau_crud/persistance"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteFlagUpdates(t *testing.T) {
+	table := Table{Name: `TEST`, SoftDelete: SoftDelete{Column: `IS_DELETED`, DeletedBy: `DELETED_BY`}}
+	updates := table.softDeleteUpdates(`ME`, time.Now())
+	if len(updates) != 2 {
+		t.Fatalf(`expected 2 updates but got %v`, len(updates))
+	}
+	flag := updates[0].(*p.UpdateClause)
+	if flag.Identifier != `IS_DELETED` || flag.NewValue != true {
+		t.Fatalf(`expected IS_DELETED=true but got %v=%v`, flag.Identifier, flag.NewValue)
+	}
+	deletedBy := updates[1].(*p.UpdateClause)
+	if deletedBy.Identifier != `DELETED_BY` || deletedBy.NewValue != `ME` {
+		t.Fatalf(`expected DELETED_BY=ME but got %v=%v`, deletedBy.Identifier, deletedBy.NewValue)
+	}
+	expected := `("IS_DELETED" IS NULL OR "IS_DELETED"=FALSE)`
+	if where := table.notDeletedClause().ToSqlSnippet().Snippet; where != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, where)
+	}
+}
+
+func TestSoftDeleteTimestampUpdates(t *testing.T) {
+	table := Table{Name: `TEST`, SoftDelete: SoftDelete{Column: `DELETED_AT`, Type: `timestamp`}}
+	updates := table.softDeleteUpdates(`ME`, time.Now())
+	if len(updates) != 1 {
+		t.Fatalf(`expected 1 update but got %v`, len(updates))
+	}
+	if _, ok := updates[0].(*p.UpdateClause).NewValue.(string); !ok {
+		t.Fatalf(`expected a timestamp string but got %T`, updates[0].(*p.UpdateClause).NewValue)
+	}
+	expected := `"DELETED_AT" IS NULL`
+	if where := table.notDeletedClause().ToSqlSnippet().Snippet; where != expected {
+		t.Fatalf(`expected '%v' but got '%v'`, expected, where)
+	}
+}
+
+func TestInvalidSoftDeleteType(t *testing.T) {
+	err := validateTables(Connection{Tables: []Table{{Name: `TEST`, SoftDelete: SoftDelete{Column: `DELETED`, Type: `invalid`}}}})
+	if err == nil {
+		t.Fatalf(`expected error but got none`)
+	}
+	t.Log(err.Error())
+}
+
+func TestGetTableIsCaseInsensitive(t *testing.T) {
+	s := &Server{Settings: Settings{Connections: []Connection{{Name: `test`, Tables: []Table{{Name: `tableau_crud_test`, HistoryTable: `HISTORY`}}}}}}
+	table := s.getTable(`TEST`, `TABLEAU_CRUD_TEST`)
+	if table.HistoryTable != `HISTORY` {
+		t.Fatalf(`expected HISTORY but got '%v'`, table.HistoryTable)
+	}
+	if table.Name != `TABLEAU_CRUD_TEST` {
+		t.Fatalf(`expected requested table name but got '%v'`, table.Name)
+	}
+}
+
+type updatePersistor struct {
+	p.Persistor
+	where   []p.SqlSnippetGenerator
+	updates []p.SqlSnippetGenerator
+}
+
+func (u *updatePersistor) Update(_ context.Context, _ string, where []p.SqlSnippetGenerator, updates []p.SqlSnippetGenerator) (int64, error) {
+	u.where = where
+	u.updates = updates
+	return 1, nil
+}
+
+func TestCheckUpdatableRejectsSoftDeleteColumns(t *testing.T) {
+	table := Table{
+		Name:           `TEST`,
+		SoftDelete:     SoftDelete{Column: `IS_DELETED`, DeletedBy: `DELETED_BY`},
+		ManagedColumns: v.ManagedColumns{ChangedBy: `CHANGED_BY`},
+	}
+	err := table.checkUpdatable(map[string]interface{}{`IS_DELETED`: false, `CHANGED_BY`: `someone`, `NAME`: `ok`})
+	validationErr, ok := err.(*v.ValidationError)
+	if !ok || len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != `IS_DELETED` {
+		t.Fatalf(`expected a soft delete error only but got %v`, err)
+	}
+	if err = table.checkUpdatable(map[string]interface{}{`NAME`: `ok`}); err != nil {
+		t.Fatalf(`expected no error but got %v`, err.Error())
+	}
+}
+
+func TestUpdateExcludesSoftDeletedRows(t *testing.T) {
+	persistor := &updatePersistor{}
+	s := &Server{
+		Settings:   Settings{ApiKey: `12345`, Connections: []Connection{{Name: `test`, Tables: []Table{{Name: `TEST`, SoftDelete: SoftDelete{Column: `IS_DELETED`}}}}}},
+		Persistors: map[string]p.Persistor{`test`: persistor},
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(`POST`, `/api/update`, strings.NewReader(`{"ApiKey":"12345","Connection":"test","Table":"TEST","Where":[],"Updates":{"NAME":"new"}}`))
+	s.handleUpdate(w, r)
+	if w.Code != 200 {
+		t.Fatalf(`expected 200 but got %v: %v`, w.Code, w.Body.String())
+	}
+	if len(persistor.where) != 1 {
+		t.Fatalf(`expected the not deleted clause in the where clause but got %v`, persistor.where)
+	}
+}
+
+func TestUpdateOverridesManagedColumns(t *testing.T) {
+	persistor := &updatePersistor{}
+	table := Table{Name: `TEST`, ManagedColumns: v.ManagedColumns{ChangedBy: `CHANGED_BY`}}
+	sink := &memorySink{}
+	s := &Server{
+		Settings:   Settings{ApiKey: `12345`, Connections: []Connection{{Name: `test`, Tables: []Table{table}}}},
+		Persistors: map[string]p.Persistor{`test`: persistor},
+		Audit:      sink,
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(`POST`, `/api/update`, strings.NewReader(`{"ApiKey":"12345","Connection":"test","Table":"TEST","Where":[],"Updates":{"NAME":"new","CHANGED_BY":"ME"}}`))
+	s.handleUpdate(w, r)
+	if w.Code != 200 {
+		t.Fatalf(`expected 200 but got %v: %v`, w.Code, w.Body.String())
+	}
+	changedBy := make([]interface{}, 0)
+	for _, generator := range persistor.updates {
+		if update := generator.(*p.UpdateClause); update.Identifier == `CHANGED_BY` {
+			changedBy = append(changedBy, update.NewValue)
+		}
+	}
+	if len(changedBy) != 1 || changedBy[0] != sharedApiKeyUser {
+		t.Fatalf(`expected CHANGED_BY to be set by the server only but got %v`, changedBy)
+	}
+	if len(sink.entries) != 1 || sink.entries[0].Values[`CHANGED_BY`] != sharedApiKeyUser || sink.entries[0].Values[`NAME`] != `new` {
+		t.Fatalf(`expected the applied updates in the audit entry but got %+v`, sink.entries)
+	}
+}
+
+type currentRowsTx struct {
+	p.Transaction
+	query p.SelectQuery
+	rows  *p.QueryResult
+}
+
+func (c *currentRowsTx) Query(query p.SelectQuery) (*p.QueryResult, error) {
+	c.query = query
+	return c.rows, nil
+}
+
+func (c *currentRowsTx) Rollback() error {
+	return nil
+}
+
+type currentRowsPersistor struct {
+	updatePersistor
+	tx *currentRowsTx
+}
+
+func (c *currentRowsPersistor) Begin(_ context.Context) (p.Transaction, error) {
+	return c.tx, nil
+}
+
+func TestUpdateChecksPartialRulesAgainstCurrentRows(t *testing.T) {
+	rules := []v.ExpressionRule{{Expression: `isNull(CLOSED) or isSet(RESOLUTION)`, Field: `RESOLUTION`}}
+	tests := []struct {
+		updates  string
+		rows     *p.QueryResult
+		expected int
+	}{
+		{`{"RESOLUTION":"Fixed"}`, &p.QueryResult{ColumnNames: []string{`CLOSED`}, RowCount: 1, Data: [][]interface{}{{`2020-01-01`}}}, 200},
+		{`{"CLOSED":"2020-01-01"}`, &p.QueryResult{ColumnNames: []string{`RESOLUTION`}, RowCount: 2, Data: [][]interface{}{{`Fixed`, nil}}}, 400},
+		{`{"CLOSED":"2020-01-01"}`, &p.QueryResult{ColumnNames: []string{`RESOLUTION`}, RowCount: 1, Data: [][]interface{}{{`Fixed`}}}, 200},
+	}
+	for _, test := range tests {
+		persistor := &currentRowsPersistor{tx: &currentRowsTx{rows: test.rows}}
+		s := &Server{
+			Settings:   Settings{ApiKey: `12345`, Connections: []Connection{{Name: `test`, Tables: []Table{{Name: `TEST`, Rules: rules}}}}},
+			Persistors: map[string]p.Persistor{`test`: persistor},
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(`POST`, `/api/update`, strings.NewReader(`{"ApiKey":"12345","Connection":"test","Table":"TEST","Where":[],"Updates":`+test.updates+`}`))
+		s.handleUpdate(w, r)
+		if w.Code != test.expected {
+			t.Fatalf(`expected %v for %v but got %v: %v`, test.expected, test.updates, w.Code, w.Body.String())
+		}
+		if len(persistor.tx.query.Fields) != 1 || !persistor.tx.query.Distinct {
+			t.Fatalf(`expected the missing rule field to be read but got %+v`, persistor.tx.query)
+		}
+	}
+}
+
+func TestValidateTablesKeepsCompiledDefaults(t *testing.T) {
+	connection := Connection{Tables: []Table{{Name: `TEST`, Defaults: map[string]string{`STATUS`: `'Open'`}}}}
+	err := validateTables(connection)
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if connection.Tables[0].defaults[`STATUS`] == nil {
+		t.Fatalf(`expected the compiled default to be kept`)
+	}
+	values, err := connection.Tables[0].applyDefaults(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf(`got error %v`, err.Error())
+	}
+	if values[`STATUS`] != `Open` {
+		t.Fatalf(`expected Open but got %v`, values[`STATUS`])
+	}
+}
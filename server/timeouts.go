@@ -0,0 +1,23 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// operationContext derives the context for a database operation from the
+// request, so that queries are cancelled when the client disconnects, and
+// applies the connection's timeout for the operation if one is configured.
+func (s *Server) operationContext(r *http.Request, connection string, operation string) (context.Context, context.CancelFunc) {
+	for _, conn := range s.Settings.Connections {
+		if !strings.EqualFold(conn.Name, connection) {
+			continue
+		}
+		if seconds := conn.OperationTimeouts[operation]; seconds > 0 {
+			return context.WithTimeout(r.Context(), time.Duration(seconds)*time.Second)
+		}
+	}
+	return context.WithCancel(r.Context())
+}
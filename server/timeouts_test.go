@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOperationContextTimeout(t *testing.T) {
+	s := &Server{Settings: Settings{Connections: []Connection{{Name: `Test`, OperationTimeouts: map[string]int{`export`: 60}}}}}
+	r := httptest.NewRequest(`POST`, `https://test.com/api/export`, nil)
+	ctx, cancel := s.operationContext(r, `test`, `export`)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf(`expected a deadline within a minute but got %v (%v)`, deadline, ok)
+	}
+	ctx, cancel = s.operationContext(r, `test`, `select`)
+	defer cancel()
+	if _, ok = ctx.Deadline(); ok {
+		t.Fatalf(`expected no deadline for an operation without a timeout`)
+	}
+}
+
+func TestOperationContextCancelledWithRequest(t *testing.T) {
+	s := &Server{}
+	requestCtx, cancelRequest := context.WithCancel(context.Background())
+	r := httptest.NewRequest(`POST`, `https://test.com/api/select`, nil).WithContext(requestCtx)
+	ctx, cancel := s.operationContext(r, `test`, `select`)
+	defer cancel()
+	cancelRequest()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf(`expected operation to be cancelled with the request`)
+	}
+}